@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/crackc0der/currency/internal/currency"
+)
+
+var (
+	errExportUsage = errors.New(
+		"usage: currency export [-format json|csv|xml|text] rates | history -currency NAME [-from RFC3339] [-to RFC3339]")
+	errBackfillUsage = errors.New("usage: currency backfill file.csv...")
+)
+
+// runFetchOnce implements `currency fetch-once [-format f]`: one CurrencyMonitor run
+// whose result is printed, for triggering fetches from cron or CI. It fails if
+// the provider or the database does.
+func runFetchOnce(configPath string, args []string) error {
+	flags := flag.NewFlagSet("fetch-once", flag.ContinueOnError)
+	format := flags.String("format", "json", "output format: json, csv, xml or text")
+
+	if err := flags.Parse(args); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	outputFormat, err := currency.ParseFormat(*format)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx := context.Background()
+
+	app := newApp(ctx, configPath, config.ComponentProvider)
+	defer app.repository.Close()
+
+	currencies, err := app.service.Fetch(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return currency.EncodeCurrencies(os.Stdout, outputFormat, currencies) //nolint:wrapcheck
+}
+
+// runExport implements `currency export rates` and `currency export history`,
+// which print the same data as GET /rates and GET /rates/{name}/history.
+func runExport(configPath string, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "output format: json, csv, xml or text")
+	name := flags.String("currency", "", "currency of the history export")
+	from := flags.String("from", "", "start of the history export, RFC 3339 (default a day before -to)")
+	to := flags.String("to", "", "end of the history export, RFC 3339 (default now)")
+
+	if err := flags.Parse(args); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	outputFormat, err := currency.ParseFormat(*format)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx := context.Background()
+
+	switch flags.Arg(0) {
+	case "rates":
+		app := newApp(ctx, configPath)
+		defer app.repository.Close()
+
+		currencies, err := app.service.GetCurrencies(ctx)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return currency.EncodeCurrencies(os.Stdout, outputFormat, currencies) //nolint:wrapcheck
+	case "history":
+		if *name == "" {
+			return errExportUsage
+		}
+
+		fromTime, err := parseTimeFlag("from", *from)
+		if err != nil {
+			return err
+		}
+
+		toTime, err := parseTimeFlag("to", *to)
+		if err != nil {
+			return err
+		}
+
+		app := newApp(ctx, configPath)
+		defer app.repository.Close()
+
+		history, err := app.service.GetHistory(ctx, strings.ToUpper(*name), fromTime, toTime)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return currency.EncodeHistory(os.Stdout, outputFormat, history) //nolint:wrapcheck
+	default:
+		return errExportUsage
+	}
+}
+
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("-%s: %w", name, err)
+	}
+
+	return parsed, nil
+}
+
+// runBackfill implements `currency backfill file.csv...`. "-" reads CSV from stdin.
+func runBackfill(configPath string, args []string) error {
+	if len(args) == 0 {
+		return errBackfillUsage
+	}
+
+	ctx := context.Background()
+
+	app := newApp(ctx, configPath)
+	defer app.repository.Close()
+
+	for _, path := range args {
+		if err := backfillFile(ctx, app.service, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func backfillFile(ctx context.Context, service *currency.Service, path string) error {
+	file := os.Stdin
+
+	if path != "-" {
+		var err error
+
+		file, err = os.Open(path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		defer file.Close()
+	}
+
+	result, err := service.BackfillCSV(ctx, file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	printBackfill(path, result)
+
+	return nil
+}
+
+func printBackfill(source string, result currency.BackfillResult) {
+	fmt.Printf("%s: read %d, inserted %d, skipped %d existing (%s)\n", source, result.Read, result.Inserted,
+		int64(result.Read)-result.Inserted, strings.Join(result.Currencies, ", "))
+}
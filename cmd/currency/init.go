@@ -3,61 +3,278 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/crackc0der/currency/config"
 	"github.com/crackc0der/currency/internal/currency"
+	"github.com/crackc0der/currency/internal/currency/currencypb"
+	"github.com/crackc0der/currency/internal/redact"
 	"github.com/go-co-op/gocron"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
-func Run() {
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	router := mux.NewRouter()
-	scheduler := gocron.NewScheduler(time.UTC)
-	timeout := 10
-	idleTimeout := 15
-	MaxHeaderBytes := 20
-	readHeaderTimeout := 5
+// storedRatesPollInterval is how often a process serving the API checks the
+// database for rates stored by another process.
+const storedRatesPollInterval = 15 * time.Second
+
+// quarantinePollInterval is how often the bot checks the database for quotes
+// quarantined by any process.
+const quarantinePollInterval = 15 * time.Second
+
+// components selects what a process runs. The API is HTTP and gRPC; a process
+// without it still serves /metrics, /healthz and /readyz.
+type components struct {
+	api  bool
+	jobs bool
+	bot  bool
+}
+
+//nolint:gochecknoglobals
+var allComponents = components{api: true, jobs: true, bot: true}
 
-	conf, err := config.NewConfig()
+// needs returns the components whose credentials the configuration must have:
+// the jobs fetch from the provider.
+func (c components) needs() []config.Component {
+	var needs []config.Component
+
+	if c.jobs {
+		needs = append(needs, config.ComponentProvider)
+	}
+
+	if c.bot {
+		needs = append(needs, config.ComponentBot)
+	}
+
+	return needs
+}
+
+// app holds what every command needs: the configuration, the logging set up
+// with secret redaction, the repository and the service.
+type app struct {
+	conf       *config.Config
+	redactor   *redact.Redactor
+	handler    slog.Handler
+	logger     *slog.Logger
+	repository *currency.Repository
+	service    *currency.Service
+}
+
+func newApp(ctx context.Context, configPath string, needs ...config.Component) *app {
+	conf, err := config.NewConfig(configPath, needs...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	redactor := redact.New(conf.Secrets()...)
+	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{ReplaceAttr: redactor.ReplaceAttr})
+	logger := slog.New(handler)
+
+	// Route the standard logger, used by log.Fatal and the bot, through the redacting handler.
+	slog.SetDefault(logger)
+
 	dsn := config.GetDSN(conf)
 
+	if conf.DataBase.AutoMigrate {
+		if err := autoMigrate(ctx, dsn, logger); err != nil {
+			log.Fatal("error migrating the database: ", err)
+		}
+	}
+
 	repository, err := currency.NewRepository(dsn)
 	if err != nil {
 		log.Fatal("error creating repository: ", err)
 	}
 
-	service := currency.NewService(repository, logger, conf)
+	return &app{
+		conf:       conf,
+		redactor:   redactor,
+		handler:    handler,
+		logger:     logger,
+		repository: repository,
+		service:    currency.NewService(repository, logger, conf),
+	}
+}
+
+// Run starts the selected components and blocks until SIGINT or SIGTERM.
+//
+//nolint:funlen,gocognit,cyclop
+func Run(configPath string, run components) {
+	router := mux.NewRouter()
+	timeout := 10
+	idleTimeout := 15
+	MaxHeaderBytes := 20
+	readHeaderTimeout := 5
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	endpoint := currency.NewEndpoint(service, logger, conf)
+	app := newApp(ctx, configPath, run.needs()...)
+	conf, logger, service := app.conf, app.logger, app.service
 
-	_, _ = scheduler.Every(conf.TimeOutUpdate).Hours().Do(service.CurrencyMonitor)
-	_, _ = scheduler.Every(conf.TimeOutUpdatePerHour).Hours().Do(service.SetChangesPerHour)
+	health := currency.NewHealth(service, logger)
 
-	go scheduler.StartBlocking()
-	go currency.BotRun(conf.BOTAPIKey, service)
+	newElector := func(int64) *currency.Elector { return nil }
+
+	if conf.Leader.Election {
+		retry := time.Duration(conf.Leader.RetryInterval) * time.Second
+		newElector = func(key int64) *currency.Elector {
+			return currency.NewElector(app.repository, key, retry, logger)
+		}
+	}
 
-	router.HandleFunc("/rates", endpoint.GetCurrencies)
-	router.HandleFunc("/rates/{name}", endpoint.GetCurrency)
+	// Jobs and the bot run only while this replica leads them, under separate
+	// locks so that they can also run as separate deployments.
+	leaderCtx, stopLeading := context.WithCancel(context.Background())
+	defer stopLeading()
+
+	var (
+		leaders   sync.WaitGroup
+		scheduler *currency.Scheduler
+		bot       *currency.Bot
+	)
+
+	if run.jobs {
+		scheduler = currency.NewScheduler(gocron.NewScheduler(time.UTC), service, logger)
+		if err := scheduler.Schedule(conf); err != nil {
+			log.Fatal("error scheduling jobs: ", err)
+		}
+
+		elector := newElector(conf.Leader.LockKey)
+		health.WatchJobs(elector)
+
+		leaders.Add(1)
+
+		go func() {
+			defer leaders.Done()
+
+			elector.Run(leaderCtx, func(ctx context.Context) {
+				scheduler.Start()
+
+				delivering := make(chan struct{})
+
+				go func() {
+					defer close(delivering)
+					service.DeliverWebhooks(ctx)
+				}()
+
+				<-ctx.Done()
+				scheduler.Stop()
+				<-delivering
+			})
+		}()
+	}
+
+	if run.bot {
+		var err error
+
+		bot, err = currency.NewBot(conf.BOTAPIKey, service)
+		if err != nil {
+			log.Fatal("error creating bot: ", err)
+		}
+
+		// Events do not leave the process, so a bot without the jobs never hears about fetches.
+		if !run.jobs {
+			logger.Info("fetch failure notices are off: the bot runs without the jobs")
+		}
+
+		elector := newElector(conf.Leader.LockKey + 1)
+		health.WatchBot(bot, elector)
+
+		leaders.Add(1)
+
+		go func() {
+			defer leaders.Done()
+
+			elector.Run(leaderCtx, func(ctx context.Context) {
+				if run.jobs {
+					go bot.WatchEvents(ctx)
+				}
+
+				go service.NotifyQuarantine(ctx, quarantinePollInterval, bot)
+				bot.Run(ctx)
+			})
+		}()
+	}
+
+	// Streams only see rates stored by this process, so pick up those stored by
+	// the replica or worker that leads the jobs. Rates this process published are skipped.
+	if run.api {
+		go service.WatchStored(leaderCtx, storedRatesPollInterval)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	defer signal.Stop(hangup)
+
+	reload := reloader{
+		path:      configPath,
+		needs:     run.needs(),
+		startup:   conf,
+		service:   service,
+		scheduler: scheduler,
+		bot:       bot,
+		redactor:  app.redactor,
+		logger:    logger,
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				reload.reload()
+			}
+		}
+	}()
+
+	router.Use(currency.MetricsMiddleware)
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/healthz", health.Liveness)
+	router.HandleFunc("/readyz", health.Readiness)
+
+	if run.api {
+		endpoint := currency.NewEndpoint(service, logger, conf)
+
+		router.HandleFunc("/rates", endpoint.GetCurrencies)
+		router.HandleFunc("/rates/stream", endpoint.StreamCurrencies).Methods(http.MethodGet)
+		router.HandleFunc("/rates/{name}", endpoint.GetCurrency)
+		router.HandleFunc("/rates/{name}/history", endpoint.GetHistory)
+		router.HandleFunc("/rates/{name}/indicators", endpoint.GetIndicators).Methods(http.MethodGet)
+		router.HandleFunc("/rates/{name}/stats", endpoint.GetStats).Methods(http.MethodGet)
+		router.HandleFunc("/ws", endpoint.ServeWebSocket)
+
+		admin := router.PathPrefix("/admin").Subrouter()
+		admin.Use(endpoint.RequireAdmin)
+		admin.HandleFunc("/quarantine", endpoint.ListQuarantine).Methods(http.MethodGet)
+		admin.HandleFunc("/quarantine/{id:[0-9]+}/accept", endpoint.AcceptQuarantined).Methods(http.MethodPost)
+		admin.HandleFunc("/quarantine/{id:[0-9]+}/reject", endpoint.RejectQuarantined).Methods(http.MethodPost)
+		admin.HandleFunc("/webhooks", endpoint.CreateWebhook).Methods(http.MethodPost)
+		admin.HandleFunc("/webhooks", endpoint.ListWebhooks).Methods(http.MethodGet)
+		admin.HandleFunc("/webhooks/{id:[0-9]+}", endpoint.DeleteWebhook).Methods(http.MethodDelete)
+		admin.HandleFunc("/webhooks/{id:[0-9]+}/deliveries", endpoint.ListWebhookDeliveries).Methods(http.MethodGet)
+	}
 
 	srv := http.Server{
-		Addr:           ":8080",
+		Addr:           conf.Host.HostPort,
 		Handler:        router,
 		ReadTimeout:    time.Duration(timeout) * time.Second,
 		WriteTimeout:   time.Duration(timeout) * time.Second,
 		IdleTimeout:    time.Duration(idleTimeout) * time.Second,
 		MaxHeaderBytes: 1 << MaxHeaderBytes,
-		ErrorLog:       log.New(os.Stderr, "http: ", log.LstdFlags),
+		ErrorLog:       slog.NewLogLogger(app.handler, slog.LevelError),
 		ConnState:      nil,
 		TLSConfig:      nil,
 		TLSNextProto:   make(map[string]func(*http.Server, *tls.Conn, http.Handler)),
@@ -71,7 +288,182 @@ func Run() {
 		DisableGeneralOptionsHandler: true,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatal(err)
+	// Streaming handlers never finish on their own, so end them before Shutdown waits for them.
+	srv.RegisterOnShutdown(service.Updates().Close)
+
+	var grpcServer *grpc.Server
+
+	if run.api && conf.Host.GRPCPort != "" {
+		grpcServer = grpc.NewServer()
+		currencypb.RegisterCurrencyServiceServer(grpcServer, currency.NewGRPCServer(service, logger))
+
+		go serveGRPC(grpcServer, conf.Host.GRPCPort, stop, logger)
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("http server failed", slog.Any("error", err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shutdownTimeout := service.Config().ShutdownTimeout
+
+	logger.Info("shutting down", slog.Int("timeoutSeconds", shutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(shutdownTimeout)*time.Second)
+	defer cancel()
+
+	shutdownStep(shutdownCtx, logger, "http server", func() {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Error("error shutting down http server", slog.Any("error", err))
+		}
+	})
+
+	if grpcServer != nil {
+		shutdownStep(shutdownCtx, logger, "grpc server", grpcServer.GracefulStop)
+	}
+
+	// Stopping the scheduler waits for a CurrencyMonitor run that is in progress,
+	// and the advisory locks are released only after the jobs and the bot stopped.
+	shutdownStep(shutdownCtx, logger, "scheduler and bot", func() {
+		stopLeading()
+		leaders.Wait()
+	})
+
+	shutdownStep(shutdownCtx, logger, "database pool", app.repository.Close)
+
+	logger.Info("shutdown complete")
+}
+
+// reloader rereads the configuration on SIGHUP. An invalid configuration is
+// rejected and the current one stays in effect. Pairs, provider, schedules,
+// admin chats and secrets apply live; listeners, the database and the bot token
+// only change on restart.
+type reloader struct {
+	path      string
+	needs     []config.Component
+	startup   *config.Config
+	service   *currency.Service
+	scheduler *currency.Scheduler
+	bot       *currency.Bot
+	redactor  *redact.Redactor
+	logger    *slog.Logger
+}
+
+func (r reloader) reload() {
+	// Everything that can fail is checked before anything is applied, so a
+	// rejected configuration is not half in effect.
+	conf, err := config.NewConfig(r.path, r.needs...)
+	if err == nil && r.scheduler != nil {
+		err = r.scheduler.Check(conf)
+	}
+
+	if err == nil {
+		err = r.service.Reload(conf)
+	}
+
+	if err != nil {
+		r.logger.Error("configuration reload rejected, keeping the current configuration", slog.Any("error", err))
+		r.notifyAdmins("Configuration reload rejected: " + r.redactor.String(err.Error()))
+
+		return
+	}
+
+	r.redactor.Add(conf.Secrets()...)
+
+	if r.scheduler != nil {
+		if err := r.scheduler.Schedule(conf); err != nil {
+			r.logger.Error("error rescheduling jobs", slog.Any("error", err))
+		}
+	}
+
+	for _, field := range r.restartRequired(conf) {
+		r.logger.Warn("configuration change requires a restart", slog.String("field", field))
+	}
+
+	r.logger.Info("configuration reloaded", slog.Any("currencies", conf.CurrencyNames()))
+	r.notifyAdmins("Configuration reloaded.")
+}
+
+// notifyAdmins reaches the admins through the bot if this process runs it.
+func (r reloader) notifyAdmins(message string) {
+	if r.bot != nil {
+		r.bot.NotifyAdmins(message)
+	}
+}
+
+// restartRequired lists the sections of conf that differ from the configuration
+// the process was started with and cannot be applied live.
+func (r reloader) restartRequired(conf *config.Config) []string {
+	var fields []string
+
+	if conf.DataBase != r.startup.DataBase {
+		fields = append(fields, "dataBase")
+	}
+
+	if conf.Host != r.startup.Host {
+		fields = append(fields, "host")
+	}
+
+	if conf.BOTAPIKey != r.startup.BOTAPIKey {
+		fields = append(fields, "botApiKey")
+	}
+
+	if conf.Leader != r.startup.Leader {
+		fields = append(fields, "leader")
+	}
+
+	return fields
+}
+
+func autoMigrate(ctx context.Context, dsn string, logger *slog.Logger) error {
+	migrator, closeConn, err := newMigrator(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		logger.Info("applied migration", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// shutdownStep runs step and waits for it until ctx expires, so that one stuck
+// component cannot hold the process past the shutdown deadline.
+func shutdownStep(ctx context.Context, logger *slog.Logger, name string, step func()) {
+	done := make(chan struct{})
+
+	go func() {
+		step()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("stopped", slog.String("component", name))
+	case <-ctx.Done():
+		logger.Error("did not stop before the shutdown deadline", slog.String("component", name))
+	}
+}
+
+func serveGRPC(server *grpc.Server, addr string, stop context.CancelFunc, logger *slog.Logger) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("error listening for gRPC", slog.Any("error", err))
+		stop()
+
+		return
+	}
+
+	if err := server.Serve(listener); err != nil {
+		logger.Error("grpc server failed", slog.Any("error", err))
+		stop()
 	}
 }
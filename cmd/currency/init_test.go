@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownSteps(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	order := make(chan string, 3)
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	started := time.Now()
+
+	shutdownStep(ctx, logger, "http server", func() { order <- "http server" })
+	shutdownStep(ctx, logger, "scheduler", func() { order <- "scheduler" })
+	shutdownStep(ctx, logger, "stuck", func() { <-stuck })
+	shutdownStep(ctx, logger, "database pool", func() { order <- "database pool" })
+
+	// A stuck step holds shutdown only until the deadline, and the later steps still run.
+	assert.Less(t, time.Since(started), time.Second)
+	for _, want := range []string{"http server", "scheduler", "database pool"} {
+		assert.Equal(t, want, <-order)
+	}
+}
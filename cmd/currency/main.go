@@ -1,5 +1,65 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	_ "time/tzdata" // bot timezones must resolve in images without a zoneinfo database
+)
+
+const usage = `usage: currency [-config path] [command]
+
+commands:
+  run         HTTP and gRPC API, scheduled jobs and the Telegram bot (default)
+  serve       HTTP and gRPC API only
+  worker      scheduled jobs only
+  bot         Telegram bot only
+  fetch-once  fetch and store rates once and print them
+  export      print stored rates or history
+  backfill    import history from CSV files
+  migrate     apply or revert database migrations
+`
+
 func main() {
-	Run()
+	configPath := flag.String("config", "", "path to the config file (default $CURRENCY_CONFIG or config/config.yml)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command, args := flag.Arg(0), flag.Args()
+
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	var err error
+
+	switch command {
+	case "", "run":
+		Run(*configPath, allComponents)
+	case "serve":
+		Run(*configPath, components{api: true})
+	case "worker":
+		Run(*configPath, components{jobs: true})
+	case "bot":
+		Run(*configPath, components{bot: true})
+	case "fetch-once":
+		err = runFetchOnce(*configPath, args)
+	case "export":
+		err = runExport(*configPath, args)
+	case "backfill":
+		err = runBackfill(*configPath, args)
+	case "migrate":
+		err = runMigrate(*configPath, args)
+	default:
+		flag.Usage()
+		os.Exit(2) //nolint:mnd
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/crackc0der/currency/internal/migrate"
+	"github.com/crackc0der/currency/migrations"
+	"github.com/jackc/pgx/v5"
+)
+
+const migrateUsage = "usage: currency migrate up | down [steps] | status"
+
+var errMigrateUsage = errors.New(migrateUsage)
+
+// runMigrate implements `currency migrate up|down [steps]|status`.
+func runMigrate(configPath string, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	conf, err := config.NewConfig(configPath)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx := context.Background()
+
+	migrator, closeConn, err := newMigrator(ctx, config.GetDSN(conf))
+	if err != nil {
+		return err
+	}
+	defer closeConn()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err //nolint:wrapcheck
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return errMigrateUsage
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err //nolint:wrapcheck
+	case "status":
+		return printStatus(ctx, migrator)
+	default:
+		return errMigrateUsage
+	}
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator) error {
+	statuses, unknown, err := migrator.Status(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:mnd
+	fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED")
+
+	for _, status := range statuses {
+		applied := "pending"
+		if !status.AppliedAt.IsZero() {
+			applied = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(writer, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+
+	for _, version := range unknown {
+		fmt.Fprintf(writer, "%04d\t?\tapplied, unknown to this binary\n", version)
+	}
+
+	return writer.Flush() //nolint:wrapcheck
+}
+
+// newMigrator connects to dsn and loads the embedded migrations. The returned
+// function closes the connection.
+func newMigrator(ctx context.Context, dsn string) (*migrate.Migrator, func(), error) {
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	return migrate.NewMigrator(conn, loaded), func() { _ = conn.Close(context.Background()) }, nil
+}
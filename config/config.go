@@ -1,53 +1,271 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"sort"
 
 	"gopkg.in/yaml.v2"
 )
 
+// DefaultPath is read when no config path is given; unlike an explicit path, it may be missing.
+const DefaultPath = "config/config.yml"
+
+const (
+	// defaultShutdownTimeout is in seconds.
+	defaultShutdownTimeout = 30
+	// defaultProviderTimeout is in seconds.
+	defaultProviderTimeout = 3
+	// defaultLeaderRetryInterval is in seconds.
+	defaultLeaderRetryInterval = 5
+	// defaultLeaderLockKey is an arbitrary advisory lock key ("curr" in ASCII).
+	defaultLeaderLockKey = 0x63757272
+	// defaultAnomalyWindow is the number of recent prices a new one is compared with.
+	defaultAnomalyWindow = 20
+	// defaultAnomalyMaxJumpPercent only catches glitches, not ordinary volatility.
+	defaultAnomalyMaxJumpPercent = 50
+	// defaultAnomalyConfirmAfter accepts a new price level after three consistent fetches.
+	defaultAnomalyConfirmAfter = 3
+	// defaultCacheTTL bounds how long rates stored by another process can go unseen.
+	defaultCacheTTL = 60
+
+	// Webhook retries back off from 10 seconds, doubling, for about an hour and a half in all.
+	defaultWebhookPollInterval   = 5
+	defaultWebhookTimeout        = 10
+	defaultWebhookMaxAttempts    = 10
+	defaultWebhookInitialBackoff = 10
+	defaultWebhookMaxBackoff     = 3600
+	defaultWebhookRetentionDays  = 30
+	// defaultRetentionBatchSize keeps every delete and rollup statement short.
+	defaultRetentionBatchSize = 5000
+
+	ProviderCurrate = "currate"
+)
+
 type Config struct {
-	DataBase             DataBase `yaml:"dataBase"`
-	Host                 Host     `yaml:"host"`
-	APIKey               string   `yaml:"apiKey"`
-	BOTAPIKey            string   `yaml:"botApiKey"`
-	TimeOutUpdate        int      `yaml:"timeOutUpdate"`
-	TimeOutUpdatePerHour int      `yaml:"timeOutUpdatePerHour"`
+	DataBase             DataBase          `yaml:"dataBase"`
+	Host                 Host              `yaml:"host"`
+	Provider             Provider          `yaml:"provider"`
+	Schedules            Schedules         `yaml:"schedules"`
+	Leader               Leader            `yaml:"leader"`
+	Anomaly              Anomaly           `yaml:"anomaly"`
+	Retention            Retention         `yaml:"retention"`
+	Webhooks             Webhooks          `yaml:"webhooks"`
+	APIKey               string            `env:"API_KEY"                 yaml:"apiKey"`
+	BOTAPIKey            string            `env:"BOT_API_KEY"             yaml:"botApiKey"`
+	AdminToken           string            `env:"ADMIN_TOKEN"             yaml:"adminToken"`
+	TimeOutUpdate        int               `env:"TIMEOUT_UPDATE"          yaml:"timeOutUpdate"`
+	TimeOutUpdatePerHour int               `env:"TIMEOUT_UPDATE_PER_HOUR" yaml:"timeOutUpdatePerHour"`
+	ShutdownTimeout      int               `env:"SHUTDOWN_TIMEOUT"        yaml:"shutdownTimeout"`
+	CacheTTL             int               `env:"CACHE_TTL"               yaml:"cacheTtl"`
+	Pairs                map[string]string `env:"PAIRS"                   yaml:"pairs"`
+	AdminChatIDs         []int64           `env:"ADMIN_CHAT_IDS"          yaml:"adminChatIds"`
+	// BotTimezone is the IANA zone the bot shows times in for chats that have not set one with /timezone.
+	BotTimezone string `env:"BOT_TIMEZONE" yaml:"botTimezone"`
+	// Scales rounds the prices of a currency to that many decimal places before
+	// they are stored. Currencies without a scale keep the provider's precision.
+	Scales map[string]int `env:"SCALES" yaml:"scales"`
+}
+
+// Provider selects and configures the source of exchange rates.
+type Provider struct {
+	Name    string `env:"PROVIDER_NAME"    yaml:"name"`
+	URL     string `env:"PROVIDER_URL"     yaml:"url"`
+	Timeout int    `env:"PROVIDER_TIMEOUT" yaml:"timeout"`
+}
+
+// Leader configures leader election between replicas. Only the leader runs the
+// scheduled jobs and the bot, while every replica serves reads.
+type Leader struct {
+	Election      bool  `env:"LEADER_ELECTION"       yaml:"election"`
+	LockKey       int64 `env:"LEADER_LOCK_KEY"       yaml:"lockKey"`
+	RetryInterval int   `env:"LEADER_RETRY_INTERVAL" yaml:"retryInterval"`
+}
+
+// Anomaly configures the screening of fetched prices against recent history.
+// A price that jumps more than MaxJumpPercent from the EMA of the last Window
+// prices, or lies more than ZScore standard deviations from their mean, is
+// quarantined instead of stored. A zero threshold disables its check. Once
+// ConfirmAfter suspicious prices in a row stay within MaxJumpPercent of each
+// other, the latest is accepted as a new price level; 0 leaves every one to an
+// administrator.
+type Anomaly struct {
+	Enabled        bool    `env:"ANOMALY_ENABLED"          yaml:"enabled"`
+	Window         int     `env:"ANOMALY_WINDOW"           yaml:"window"`
+	MaxJumpPercent float64 `env:"ANOMALY_MAX_JUMP_PERCENT" yaml:"maxJumpPercent"`
+	ZScore         float64 `env:"ANOMALY_Z_SCORE"          yaml:"zScore"`
+	ConfirmAfter   int     `env:"ANOMALY_CONFIRM_AFTER"    yaml:"confirmAfter"`
+}
+
+// Retention sets for how many days history is kept at each granularity; 0 keeps
+// it forever. Raw ticks are rolled up into hourly and daily aggregates before
+// they are deleted, and rows are rolled up and deleted BatchSize at a time.
+type Retention struct {
+	RawDays    int `env:"RETENTION_RAW_DAYS"    yaml:"rawDays"`
+	HourlyDays int `env:"RETENTION_HOURLY_DAYS" yaml:"hourlyDays"`
+	DailyDays  int `env:"RETENTION_DAILY_DAYS"  yaml:"dailyDays"`
+	BatchSize  int `env:"RETENTION_BATCH_SIZE"  yaml:"batchSize"`
+}
+
+// Webhooks configures the delivery of events to registered webhooks. Every
+// value is in seconds except MaxAttempts and RetentionDays; retries wait
+// InitialBackoff, doubling up to MaxBackoff. The retention job deletes delivered
+// and failed deliveries older than RetentionDays; 0 keeps them forever.
+type Webhooks struct {
+	PollInterval   int `env:"WEBHOOKS_POLL_INTERVAL"   yaml:"pollInterval"`
+	Timeout        int `env:"WEBHOOKS_TIMEOUT"         yaml:"timeout"`
+	MaxAttempts    int `env:"WEBHOOKS_MAX_ATTEMPTS"    yaml:"maxAttempts"`
+	InitialBackoff int `env:"WEBHOOKS_INITIAL_BACKOFF" yaml:"initialBackoff"`
+	MaxBackoff     int `env:"WEBHOOKS_MAX_BACKOFF"     yaml:"maxBackoff"`
+	RetentionDays  int `env:"WEBHOOKS_RETENTION_DAYS"  yaml:"retentionDays"`
 }
 
 type DataBase struct {
-	DBHost     string `yaml:"dbHost"`
-	DBPort     string `yaml:"dbPort"`
-	DBName     string `yaml:"dbName"`
-	DBUser     string `yaml:"dbUser"`
-	DBPassword string `yaml:"dbPassword"`
+	DBHost     string `env:"DB_HOST"     yaml:"dbHost"`
+	DBPort     string `env:"DB_PORT"     yaml:"dbPort"`
+	DBName     string `env:"DB_NAME"     yaml:"dbName"`
+	DBUser     string `env:"DB_USER"     yaml:"dbUser"`
+	DBPassword string `env:"DB_PASSWORD" yaml:"dbPassword"`
+	SSLMode    string `env:"DB_SSLMODE"  yaml:"sslMode"`
+	// AutoMigrate applies pending migrations on start.
+	AutoMigrate bool `env:"DB_AUTO_MIGRATE" yaml:"autoMigrate"`
 }
 
 type Host struct {
-	HostPort string `yaml:"hostPort"`
+	HostPort string `env:"HOST_PORT" yaml:"hostPort"`
+	GRPCPort string `env:"GRPC_PORT" yaml:"grpcPort"`
 }
 
-func NewConfig() (*Config, error) {
-	var config Config
+// Default returns the configuration used for every field that neither
+// the config file nor the environment sets.
+func Default() Config {
+	return Config{
+		DataBase: DataBase{
+			DBHost:  "localhost",
+			DBPort:  "5432",
+			SSLMode: "disable",
+		},
+		Host: Host{
+			HostPort: ":8080",
+		},
+		Provider: Provider{
+			Name:    ProviderCurrate,
+			URL:     "https://currate.ru/api/",
+			Timeout: defaultProviderTimeout,
+		},
+		Schedules: Schedules{
+			MissedRuns: MissedRunsRunOnce,
+		},
+		Leader: Leader{
+			Election:      true,
+			LockKey:       defaultLeaderLockKey,
+			RetryInterval: defaultLeaderRetryInterval,
+		},
+		Anomaly: Anomaly{
+			Enabled:        true,
+			Window:         defaultAnomalyWindow,
+			MaxJumpPercent: defaultAnomalyMaxJumpPercent,
+			ConfirmAfter:   defaultAnomalyConfirmAfter,
+		},
+		Retention: Retention{
+			BatchSize: defaultRetentionBatchSize,
+		},
+		Webhooks: Webhooks{
+			PollInterval:   defaultWebhookPollInterval,
+			Timeout:        defaultWebhookTimeout,
+			MaxAttempts:    defaultWebhookMaxAttempts,
+			InitialBackoff: defaultWebhookInitialBackoff,
+			MaxBackoff:     defaultWebhookMaxBackoff,
+			RetentionDays:  defaultWebhookRetentionDays,
+		},
+		BotTimezone:          "UTC",
+		TimeOutUpdate:        1,
+		TimeOutUpdatePerHour: 1,
+		ShutdownTimeout:      defaultShutdownTimeout,
+		CacheTTL:             defaultCacheTTL,
+	}
+}
+
+// NewConfig builds the configuration from defaults, the YAML file at path and
+// CURRENCY_* environment variables, in increasing order of precedence. An empty
+// path falls back to $CURRENCY_CONFIG and then to DefaultPath. All invalid or
+// missing fields are reported together, including the credentials of components.
+func NewConfig(path string, components ...Component) (*Config, error) {
+	config := Default()
+
+	explicit := true
 
-	configFile, err := os.ReadFile("config/config.yml")
-	if err != nil {
+	if path == "" {
+		path = os.Getenv(envPrefix + "CONFIG")
+	}
+
+	if path == "" {
+		path = DefaultPath
+		explicit = false
+	}
+
+	configFile, err := os.ReadFile(path)
+
+	switch {
+	case err == nil:
+		err = yaml.Unmarshal(configFile, &config)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal config file: %w", err)
+		}
+	case explicit || !errors.Is(err, os.ErrNotExist):
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
-	err = yaml.Unmarshal(configFile, &config)
-	if err != nil {
-		return nil, fmt.Errorf("could not unmarshal config file: %w", err)
+	envErr := applyEnv(&config)
+
+	// Set after loading, since YAML would merge a default map with the configured one.
+	if len(config.Pairs) == 0 {
+		config.Pairs = map[string]string{"BTC": "BTCRUB", "ETH": "ETHRUB"}
+	}
+
+	if err := errors.Join(envErr, config.Validate(components...)); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
 	}
 
 	return &config, nil
 }
 
+// CurrencyNames returns the names of the tracked currencies in a stable order.
+func (c *Config) CurrencyNames() []string {
+	names := make([]string, 0, len(c.Pairs))
+	for name := range c.Pairs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Scale returns the number of decimal places configured for the currency name.
+func (c *Config) Scale(name string) (int32, bool) {
+	scale, ok := c.Scales[name]
+
+	return int32(scale), ok //nolint:gosec
+}
+
+// Secrets returns the values that must never appear in logs.
+func (c *Config) Secrets() []string {
+	return []string{c.APIKey, c.BOTAPIKey, c.DataBase.DBPassword, c.AdminToken}
+}
+
+// GetDSN builds the Postgres URL, escaping the credentials and database name.
 func GetDSN(config *Config) string {
-	dsn := "postgres://" + config.DataBase.DBUser + ":" + config.DataBase.DBPassword + "@" +
-		config.DataBase.DBHost + ":" + config.DataBase.DBPort + "/" +
-		config.DataBase.DBName + "?sslmode=disable"
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.DataBase.DBUser, config.DataBase.DBPassword),
+		Host:     net.JoinHostPort(config.DataBase.DBHost, config.DataBase.DBPort),
+		Path:     "/" + config.DataBase.DBName,
+		RawQuery: url.Values{"sslmode": {config.DataBase.SSLMode}}.Encode(),
+	}
 
-	return dsn
+	return dsn.String()
 }
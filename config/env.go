@@ -0,0 +1,195 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// envPrefix is prepended to the env tag of every field, e.g. CURRENCY_DB_HOST.
+	envPrefix = "CURRENCY_"
+	// fileSuffix marks a variable that holds the path to a file with the value,
+	// e.g. CURRENCY_DB_PASSWORD_FILE=/run/secrets/db_password.
+	fileSuffix = "_FILE"
+)
+
+var (
+	errUnsupportedEnvField = errors.New("unsupported field type")
+	errEnvAndFile          = errors.New("only one of the variable and its _FILE variant may be set")
+	errInvalidMapItem      = errors.New("expected key=value")
+)
+
+// applyEnv overrides the fields of config that have an env tag with the values
+// of the matching environment variables, or with the contents of the file named
+// by the variable with a _FILE suffix. Nested structs are walked recursively.
+func applyEnv(config *Config) error {
+	return applyEnvStruct(reflect.ValueOf(config).Elem())
+}
+
+func applyEnvStruct(value reflect.Value) error {
+	var errs []error
+
+	for i := range value.NumField() {
+		field := value.Field(i)
+		fieldType := value.Type().Field(i)
+
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, applyEnvStruct(field))
+
+			continue
+		}
+
+		name, ok := fieldType.Tag.Lookup("env")
+		if !ok {
+			continue
+		}
+
+		name = envPrefix + name
+
+		raw, ok, err := lookupEnv(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func lookupEnv(name string) (string, bool, error) {
+	value, hasValue := os.LookupEnv(name)
+	path, hasFile := os.LookupEnv(name + fileSuffix)
+
+	switch {
+	case hasValue && hasFile:
+		return "", false, errEnvAndFile
+	case hasFile:
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", false, fmt.Errorf("error reading %s: %w", name+fileSuffix, err)
+		}
+
+		// Secret files usually end with a newline that is not part of the value.
+		return strings.TrimRight(string(content), "\r\n"), true, nil
+	default:
+		return value, hasValue, nil
+	}
+}
+
+func setField(field reflect.Value, raw string) error {
+	//nolint:exhaustive
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer: %w", err)
+		}
+
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number: %w", err)
+		}
+
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected a boolean: %w", err)
+		}
+
+		field.SetBool(parsed)
+	case reflect.Slice:
+		return setSlice(field, raw)
+	case reflect.Map:
+		return setMap(field, raw)
+	default:
+		return fmt.Errorf("%w: %s", errUnsupportedEnvField, field.Kind())
+	}
+
+	return nil
+}
+
+// setSlice parses a comma-separated list, e.g. CURRENCY_ADMIN_CHAT_IDS=1,2.
+func setSlice(field reflect.Value, raw string) error {
+	items := splitList(raw)
+	slice := reflect.MakeSlice(field.Type(), len(items), len(items))
+
+	for i, item := range items {
+		//nolint:exhaustive
+		switch field.Type().Elem().Kind() {
+		case reflect.String:
+			slice.Index(i).SetString(item)
+		case reflect.Int64:
+			parsed, err := strconv.ParseInt(item, 10, 64)
+			if err != nil {
+				return fmt.Errorf("expected a list of integers: %w", err)
+			}
+
+			slice.Index(i).SetInt(parsed)
+		default:
+			return fmt.Errorf("%w: %s", errUnsupportedEnvField, field.Type())
+		}
+	}
+
+	field.Set(slice)
+
+	return nil
+}
+
+// setMap parses comma-separated key=value pairs, e.g. CURRENCY_PAIRS=BTC=BTCRUB,ETH=ETHRUB
+// or CURRENCY_SCALES=BTC=2,ETH=4.
+func setMap(field reflect.Value, raw string) error {
+	elemKind := field.Type().Elem().Kind()
+	if field.Type().Key().Kind() != reflect.String || (elemKind != reflect.String && elemKind != reflect.Int) {
+		return fmt.Errorf("%w: %s", errUnsupportedEnvField, field.Type())
+	}
+
+	result := reflect.MakeMap(field.Type())
+
+	for _, item := range splitList(raw) {
+		key, value, ok := strings.Cut(item, "=")
+		if !ok || key == "" || value == "" {
+			return fmt.Errorf("%w: %q", errInvalidMapItem, item)
+		}
+
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setField(elem, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+
+		result.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), elem)
+	}
+
+	field.Set(result)
+
+	return nil
+}
+
+func splitList(raw string) []string {
+	items := make([]string, 0)
+
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// MissedRunsSkip waits for the next scheduled run after a restart or a change of leader.
+	MissedRunsSkip = "skip"
+	// MissedRunsRunOnce runs a job once when a replica starts leading if its last
+	// run, on any replica, is older than its period.
+	MissedRunsRunOnce = "runOnce"
+
+	cronFieldsWithSeconds = 6
+)
+
+var (
+	errInvalidSchedule = errors.New("must be a duration such as 30s or 5m, or a cron expression")
+	errMissedRuns      = errors.New("must be skip or runOnce")
+	errInvalidDuration = errors.New("must be a non-negative duration such as 10s")
+)
+
+// Schedules overrides the hourly timeOutUpdate and timeOutUpdatePerHour intervals.
+// Empty fields keep the hourly intervals.
+type Schedules struct {
+	Monitor        string `env:"SCHEDULE_MONITOR"          yaml:"monitor"`
+	ChangesPerHour string `env:"SCHEDULE_CHANGES_PER_HOUR" yaml:"changesPerHour"`
+	Jitter         string `env:"SCHEDULE_JITTER"           yaml:"jitter"`
+	MissedRuns     string `env:"SCHEDULE_MISSED_RUNS"      yaml:"missedRuns"`
+	Retention      string `env:"SCHEDULE_RETENTION"        yaml:"retention"`
+}
+
+// Schedule is either a fixed interval aligned to wall-clock boundaries in UTC
+// (5m runs at :00, :05, ...) or a cron expression evaluated in UTC.
+type Schedule struct {
+	Every time.Duration
+	Cron  string
+	cron  cron.Schedule
+}
+
+// ParseSchedule accepts a Go duration of at least a second, a standard five-field
+// cron expression, a six-field one with seconds, or a descriptor such as @hourly.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if every, err := time.ParseDuration(spec); err == nil {
+		if every < time.Second {
+			return Schedule{}, fmt.Errorf("%w, got %q", errInvalidSchedule, spec)
+		}
+
+		return Schedule{Every: every}, nil
+	}
+
+	parser := cron.ParseStandard
+	if len(strings.Fields(spec)) == cronFieldsWithSeconds {
+		parser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow).Parse
+	}
+
+	schedule, err := parser(spec)
+	if err != nil {
+		return Schedule{}, fmt.Errorf("%w, got %q: %w", errInvalidSchedule, spec, err)
+	}
+
+	return Schedule{Cron: spec, cron: schedule}, nil
+}
+
+// WithSeconds reports whether Cron has a seconds field.
+func (s Schedule) WithSeconds() bool {
+	return len(strings.Fields(s.Cron)) == cronFieldsWithSeconds
+}
+
+// Next returns the first run after t.
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t.UTC())
+	}
+
+	return t.UTC().Truncate(s.Every).Add(s.Every)
+}
+
+// Period is the time between the next two runs after t. It is exact for
+// intervals and for regular cron expressions.
+func (s Schedule) Period(t time.Time) time.Duration {
+	if s.cron == nil {
+		return s.Every
+	}
+
+	next := s.Next(t)
+
+	return s.Next(next).Sub(next)
+}
+
+func (s Schedule) String() string {
+	if s.cron != nil {
+		return s.Cron
+	}
+
+	return s.Every.String()
+}
+
+// MonitorSchedule returns when rates are fetched.
+func (c *Config) MonitorSchedule() Schedule {
+	return c.schedule(c.Schedules.Monitor, c.TimeOutUpdate)
+}
+
+// ChangesPerHourSchedule returns when the hourly changes are recomputed.
+func (c *Config) ChangesPerHourSchedule() Schedule {
+	return c.schedule(c.Schedules.ChangesPerHour, c.TimeOutUpdatePerHour)
+}
+
+// RetentionSchedule returns when history is rolled up and expired, hourly by default.
+func (c *Config) RetentionSchedule() Schedule {
+	return c.schedule(c.Schedules.Retention, 1)
+}
+
+// Jitter is the upper bound of the random delay added to every scheduled run,
+// so that replicas and clients do not hit the provider at the same instant.
+func (c *Config) Jitter() time.Duration {
+	jitter, _ := time.ParseDuration(c.Schedules.Jitter)
+
+	return jitter
+}
+
+// schedule is only called on a validated config, so a spec that fails to parse cannot occur.
+func (c *Config) schedule(spec string, hours int) Schedule {
+	if spec == "" {
+		return Schedule{Every: time.Duration(hours) * time.Hour}
+	}
+
+	schedule, _ := ParseSchedule(spec)
+
+	return schedule
+}
+
+func (s Schedules) validate() []error {
+	var errs []error
+
+	for name, spec := range map[string]string{
+		"schedules.monitor (CURRENCY_SCHEDULE_MONITOR)":                 s.Monitor,
+		"schedules.changesPerHour (CURRENCY_SCHEDULE_CHANGES_PER_HOUR)": s.ChangesPerHour,
+		"schedules.retention (CURRENCY_SCHEDULE_RETENTION)":             s.Retention,
+	} {
+		if spec == "" {
+			continue
+		}
+
+		if _, err := ParseSchedule(spec); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", name, err))
+		}
+	}
+
+	if s.Jitter != "" {
+		if jitter, err := time.ParseDuration(s.Jitter); err != nil || jitter < 0 {
+			errs = append(errs, fmt.Errorf("schedules.jitter (CURRENCY_SCHEDULE_JITTER) %w, got %q", errInvalidDuration, s.Jitter))
+		}
+	}
+
+	switch s.MissedRuns {
+	case MissedRunsSkip, MissedRunsRunOnce:
+	default:
+		errs = append(errs, fmt.Errorf("schedules.missedRuns (CURRENCY_SCHEDULE_MISSED_RUNS) %w, got %q",
+			errMissedRuns, s.MissedRuns))
+	}
+
+	return errs
+}
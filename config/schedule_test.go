@@ -0,0 +1,84 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 10, 7, 42, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		spec       string
+		wantNext   time.Time
+		wantPeriod time.Duration
+		wantErr    bool
+	}{
+		{
+			name:       "duration aligned to the minute",
+			spec:       "5m",
+			wantNext:   time.Date(2024, 5, 1, 10, 10, 0, 0, time.UTC),
+			wantPeriod: 5 * time.Minute,
+		},
+		{
+			name:       "seconds",
+			spec:       "30s",
+			wantNext:   time.Date(2024, 5, 1, 10, 8, 0, 0, time.UTC),
+			wantPeriod: 30 * time.Second,
+		},
+		{
+			name:       "cron",
+			spec:       "*/15 * * * *",
+			wantNext:   time.Date(2024, 5, 1, 10, 15, 0, 0, time.UTC),
+			wantPeriod: 15 * time.Minute,
+		},
+		{
+			name:       "cron with seconds",
+			spec:       "*/20 * * * * *",
+			wantNext:   time.Date(2024, 5, 1, 10, 8, 0, 0, time.UTC),
+			wantPeriod: 20 * time.Second,
+		},
+		{
+			name:       "descriptor",
+			spec:       "@hourly",
+			wantNext:   time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+			wantPeriod: time.Hour,
+		},
+		{name: "too short", spec: "10ms", wantErr: true},
+		{name: "garbage", spec: "every minute", wantErr: true},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := ParseSchedule(testCase.spec)
+			if testCase.wantErr {
+				require.ErrorIs(t, err, errInvalidSchedule)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.wantNext, schedule.Next(now))
+			assert.Equal(t, testCase.wantPeriod, schedule.Period(now))
+		})
+	}
+}
+
+func TestSchedulesFallBackToHours(t *testing.T) {
+	t.Parallel()
+
+	conf := Default()
+	conf.TimeOutUpdate = 2
+	conf.Schedules.ChangesPerHour = "30m"
+
+	assert.Equal(t, 2*time.Hour, conf.MonitorSchedule().Every)
+	assert.Equal(t, 30*time.Minute, conf.ChangesPerHourSchedule().Every)
+}
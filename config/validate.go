@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	errRequired      = errors.New("is required")
+	errNotPositive   = errors.New("must be greater than zero")
+	errInvalidPort   = errors.New("must be a port number")
+	errInvalidAddr   = errors.New("must be a host:port address")
+	errSSLMode       = errors.New("must be one of disable, allow, prefer, require, verify-ca, verify-full")
+	errProvider      = errors.New("is not a supported provider")
+	errInvalidURL    = errors.New("must be an absolute URL")
+	errScale         = errors.New("must be between 0 and 18")
+	errNoPair        = errors.New("is not one of the tracked pairs")
+	errTimezone      = errors.New("must be an IANA time zone such as Europe/Moscow")
+	errAnomalyWindow = errors.New("must be at least 2")
+	errNegative      = errors.New("must not be negative")
+)
+
+// maxScale keeps scaled prices within what float clients can still read back.
+const maxScale = 18
+
+// Component is a part of the service that needs credentials of its own.
+type Component int
+
+const (
+	// ComponentProvider fetches or backfills rates from the provider, which needs apiKey.
+	ComponentProvider Component = iota + 1
+	// ComponentBot runs the Telegram bot, which needs botApiKey.
+	ComponentBot
+)
+
+// Validate reports every missing or invalid field at once. The credentials of
+// a component are only required if it is among components.
+func (c *Config) Validate(components ...Component) error {
+	var errs []error
+
+	require := func(name, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s %w", name, errRequired))
+		}
+	}
+
+	positive := func(name string, value int) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s %w", name, errNotPositive))
+		}
+	}
+
+	address := func(name, value string) {
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s %w, got %q", name, errInvalidAddr, value))
+		}
+	}
+
+	require("dataBase.dbHost (CURRENCY_DB_HOST)", c.DataBase.DBHost)
+	require("dataBase.dbName (CURRENCY_DB_NAME)", c.DataBase.DBName)
+	require("dataBase.dbUser (CURRENCY_DB_USER)", c.DataBase.DBUser)
+
+	if slices.Contains(components, ComponentProvider) {
+		require("apiKey (CURRENCY_API_KEY)", c.APIKey)
+	}
+
+	if slices.Contains(components, ComponentBot) {
+		require("botApiKey (CURRENCY_BOT_API_KEY)", c.BOTAPIKey)
+	}
+
+	if port, err := strconv.Atoi(c.DataBase.DBPort); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("dataBase.dbPort (CURRENCY_DB_PORT) %w, got %q", errInvalidPort, c.DataBase.DBPort))
+	}
+
+	switch c.DataBase.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("dataBase.sslMode (CURRENCY_DB_SSLMODE) %w, got %q", errSSLMode, c.DataBase.SSLMode))
+	}
+
+	address("host.hostPort (CURRENCY_HOST_PORT)", c.Host.HostPort)
+
+	if c.Host.GRPCPort != "" {
+		address("host.grpcPort (CURRENCY_GRPC_PORT)", c.Host.GRPCPort)
+	}
+
+	positive("timeOutUpdate (CURRENCY_TIMEOUT_UPDATE)", c.TimeOutUpdate)
+	positive("timeOutUpdatePerHour (CURRENCY_TIMEOUT_UPDATE_PER_HOUR)", c.TimeOutUpdatePerHour)
+	positive("shutdownTimeout (CURRENCY_SHUTDOWN_TIMEOUT)", c.ShutdownTimeout)
+	positive("provider.timeout (CURRENCY_PROVIDER_TIMEOUT)", c.Provider.Timeout)
+	positive("leader.retryInterval (CURRENCY_LEADER_RETRY_INTERVAL)", c.Leader.RetryInterval)
+	positive("webhooks.pollInterval (CURRENCY_WEBHOOKS_POLL_INTERVAL)", c.Webhooks.PollInterval)
+	positive("webhooks.timeout (CURRENCY_WEBHOOKS_TIMEOUT)", c.Webhooks.Timeout)
+	positive("webhooks.maxAttempts (CURRENCY_WEBHOOKS_MAX_ATTEMPTS)", c.Webhooks.MaxAttempts)
+	positive("webhooks.initialBackoff (CURRENCY_WEBHOOKS_INITIAL_BACKOFF)", c.Webhooks.InitialBackoff)
+	positive("webhooks.maxBackoff (CURRENCY_WEBHOOKS_MAX_BACKOFF)", c.Webhooks.MaxBackoff)
+
+	if c.Provider.Name != ProviderCurrate {
+		errs = append(errs, fmt.Errorf("provider.name (CURRENCY_PROVIDER_NAME) %q %w", c.Provider.Name, errProvider))
+	}
+
+	if parsed, err := url.Parse(c.Provider.URL); err != nil || !parsed.IsAbs() {
+		errs = append(errs, fmt.Errorf("provider.url (CURRENCY_PROVIDER_URL) %w, got %q", errInvalidURL, c.Provider.URL))
+	}
+
+	if _, err := time.LoadLocation(c.BotTimezone); err != nil || c.BotTimezone == "" {
+		errs = append(errs, fmt.Errorf("botTimezone (CURRENCY_BOT_TIMEZONE) %w, got %q", errTimezone, c.BotTimezone))
+	}
+
+	if c.Anomaly.Enabled {
+		if c.Anomaly.Window < 2 {
+			errs = append(errs, fmt.Errorf("anomaly.window (CURRENCY_ANOMALY_WINDOW) %w, got %d",
+				errAnomalyWindow, c.Anomaly.Window))
+		}
+
+		if c.Anomaly.MaxJumpPercent < 0 || c.Anomaly.ZScore < 0 || c.Anomaly.ConfirmAfter < 0 {
+			errs = append(errs, fmt.Errorf("anomaly.maxJumpPercent, anomaly.zScore and anomaly.confirmAfter %w",
+				errNegative))
+		}
+	}
+
+	if c.CacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("cacheTtl (CURRENCY_CACHE_TTL) %w, got %d", errNegative, c.CacheTTL))
+	}
+
+	if c.Retention.RawDays < 0 || c.Retention.HourlyDays < 0 || c.Retention.DailyDays < 0 {
+		errs = append(errs, fmt.Errorf("retention.rawDays, retention.hourlyDays and retention.dailyDays %w", errNegative))
+	}
+
+	if c.Webhooks.RetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("webhooks.retentionDays (CURRENCY_WEBHOOKS_RETENTION_DAYS) %w, got %d",
+			errNegative, c.Webhooks.RetentionDays))
+	}
+
+	if c.Retention.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("retention.batchSize (CURRENCY_RETENTION_BATCH_SIZE) %w", errNotPositive))
+	}
+
+	errs = append(errs, c.Schedules.validate()...)
+
+	for name, pair := range c.Pairs {
+		require(fmt.Sprintf("pairs.%s (CURRENCY_PAIRS)", name), pair)
+	}
+
+	scaled := make([]string, 0, len(c.Scales))
+	for name := range c.Scales {
+		scaled = append(scaled, name)
+	}
+
+	sort.Strings(scaled)
+
+	for _, name := range scaled {
+		if _, ok := c.Pairs[name]; !ok {
+			errs = append(errs, fmt.Errorf("scales.%s (CURRENCY_SCALES) %w", name, errNoPair))
+		}
+
+		if scale := c.Scales[name]; scale < 0 || scale > maxScale {
+			errs = append(errs, fmt.Errorf("scales.%s (CURRENCY_SCALES) %w, got %d", name, errScale, scale))
+		}
+	}
+
+	return errors.Join(errs...)
+}
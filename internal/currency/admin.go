@@ -0,0 +1,234 @@
+package currency
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireAdmin lets a request through only with the header
+// "Authorization: Bearer <adminToken>". Without an admin token configured the
+// admin API is disabled.
+func (e Endpoint) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		token := e.service.Config().AdminToken
+		if token == "" {
+			http.Error(writer, "admin API is disabled", http.StatusForbidden)
+
+			return
+		}
+
+		given, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writer.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(writer, "invalid admin token", http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// ListQuarantine writes the quarantined quotes as JSON, newest first. The
+// optional status query parameter is pending, accepted or rejected.
+func (e Endpoint) ListQuarantine(writer http.ResponseWriter, request *http.Request) {
+	quotes, err := e.service.ListQuarantine(request.Context(), request.URL.Query().Get("status"))
+	if errors.Is(err, errQuarantineStatus) {
+		http.Error(writer, errQuarantineStatus.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err != nil {
+		e.log.Error("error in Endpoint's method ListQuarantine", slog.Any("error", err))
+		http.Error(writer, "could not list quarantined quotes", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(quotes); err != nil {
+		e.log.Error("error in Endpoint's method ListQuarantine", slog.Any("error", err))
+	}
+}
+
+// AcceptQuarantined stores the quarantined quote with the id in the path and
+// writes it as JSON.
+func (e Endpoint) AcceptQuarantined(writer http.ResponseWriter, request *http.Request) {
+	e.resolveQuarantined(writer, request, e.service.AcceptQuarantined)
+}
+
+// RejectQuarantined discards the quarantined quote with the id in the path and
+// writes it as JSON.
+func (e Endpoint) RejectQuarantined(writer http.ResponseWriter, request *http.Request) {
+	e.resolveQuarantined(writer, request, e.service.RejectQuarantined)
+}
+
+func (e Endpoint) resolveQuarantined(
+	writer http.ResponseWriter, request *http.Request,
+	resolve func(ctx context.Context, id int64) (QuarantinedQuote, error),
+) {
+	id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, "invalid quarantined quote id", http.StatusBadRequest)
+
+		return
+	}
+
+	quote, err := resolve(request.Context(), id)
+
+	switch {
+	case errors.Is(err, errQuarantineNotFound):
+		http.Error(writer, errQuarantineNotFound.Error(), http.StatusNotFound)
+
+		return
+	case errors.Is(err, errQuarantineResolved):
+		http.Error(writer, errQuarantineResolved.Error(), http.StatusConflict)
+
+		return
+	case err != nil:
+		e.log.Error("error in Endpoint's method resolveQuarantined", slog.Any("error", err))
+		http.Error(writer, "could not resolve quarantined quote", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(quote); err != nil {
+		e.log.Error("error in Endpoint's method resolveQuarantined", slog.Any("error", err))
+	}
+}
+
+// webhookRequestLimit bounds the body of a webhook registration.
+const webhookRequestLimit = 64 << 10
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// CreateWebhook registers the webhook in the JSON body, {"url", "events" and an
+// optional "secret"}, and writes it as JSON with its secret.
+func (e Endpoint) CreateWebhook(writer http.ResponseWriter, request *http.Request) {
+	var body createWebhookRequest
+
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, webhookRequestLimit))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&body); err != nil {
+		http.Error(writer, "invalid webhook: "+err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	webhook, err := e.service.CreateWebhook(request.Context(), body.URL, body.Events, body.Secret)
+
+	switch {
+	case errors.Is(err, errWebhookURL):
+		http.Error(writer, errWebhookURL.Error(), http.StatusBadRequest)
+
+		return
+	case errors.Is(err, errWebhookTarget):
+		http.Error(writer, errWebhookTarget.Error(), http.StatusBadRequest)
+
+		return
+	case errors.Is(err, errWebhookEvents):
+		http.Error(writer, errWebhookEvents.Error(), http.StatusBadRequest)
+
+		return
+	case err != nil:
+		e.log.Error("error in Endpoint's method CreateWebhook", slog.Any("error", err))
+		http.Error(writer, "could not create webhook", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+	writer.WriteHeader(http.StatusCreated)
+
+	if err = json.NewEncoder(writer).Encode(webhook); err != nil {
+		e.log.Error("error in Endpoint's method CreateWebhook", slog.Any("error", err))
+	}
+}
+
+// ListWebhooks writes the registered webhooks as JSON, without their secrets.
+func (e Endpoint) ListWebhooks(writer http.ResponseWriter, request *http.Request) {
+	webhooks, err := e.service.ListWebhooks(request.Context())
+	if err != nil {
+		e.log.Error("error in Endpoint's method ListWebhooks", slog.Any("error", err))
+		http.Error(writer, "could not list webhooks", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(webhooks); err != nil {
+		e.log.Error("error in Endpoint's method ListWebhooks", slog.Any("error", err))
+	}
+}
+
+// DeleteWebhook removes the webhook with the id in the path and its deliveries.
+func (e Endpoint) DeleteWebhook(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, "invalid webhook id", http.StatusBadRequest)
+
+		return
+	}
+
+	err = e.service.DeleteWebhook(request.Context(), id)
+
+	switch {
+	case errors.Is(err, errWebhookNotFound):
+		http.Error(writer, errWebhookNotFound.Error(), http.StatusNotFound)
+	case err != nil:
+		e.log.Error("error in Endpoint's method DeleteWebhook", slog.Any("error", err))
+		http.Error(writer, "could not delete webhook", http.StatusInternalServerError)
+	default:
+		writer.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeliveries writes the latest deliveries of the webhook with the id
+// in the path as JSON, newest first. The optional status query parameter is
+// pending, delivered or failed.
+func (e Endpoint) ListWebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, "invalid webhook id", http.StatusBadRequest)
+
+		return
+	}
+
+	deliveries, err := e.service.ListWebhookDeliveries(request.Context(), id, request.URL.Query().Get("status"))
+	if errors.Is(err, errDeliveryStatus) {
+		http.Error(writer, errDeliveryStatus.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err != nil {
+		e.log.Error("error in Endpoint's method ListWebhookDeliveries", slog.Any("error", err))
+		http.Error(writer, "could not list webhook deliveries", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(deliveries); err != nil {
+		e.log.Error("error in Endpoint's method ListWebhookDeliveries", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,329 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	QuarantinePending  = "pending"
+	QuarantineAccepted = "accepted"
+	QuarantineRejected = "rejected"
+)
+
+var (
+	errQuarantineStatus   = errors.New("status must be one of pending, accepted, rejected")
+	errQuarantineNotFound = errors.New("quarantined quote not found")
+	errQuarantineResolved = errors.New("quarantined quote was already resolved")
+)
+
+// QuarantinedQuote is a fetched price that looked like a glitch, so it was held
+// back from the rates, min/max and history until an administrator accepts or rejects it.
+type QuarantinedQuote struct {
+	ID           int64           `json:"id"`
+	CurrencyName string          `json:"currencyName"`
+	Price        decimal.Decimal `json:"price"`
+	// Reference is the EMA of recent prices that Price was compared with.
+	Reference  decimal.Decimal `json:"reference"`
+	Reason     string          `json:"reason"`
+	QuotedAt   time.Time       `json:"quotedAt"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Status     string          `json:"status"`
+	ResolvedAt *time.Time      `json:"resolvedAt,omitempty"`
+	// Occurrences counts the suspicious prices in a row, each close to the one
+	// before, that this pending quote stands for: a currency has one pending
+	// quote, which takes the latest of them.
+	Occurrences int `json:"occurrences"`
+}
+
+// Notifier delivers messages to the administrators, such as the admin chats of the bot.
+type Notifier interface {
+	NotifyAdmins(message string)
+}
+
+// NotifyQuarantine reports to notifier the quotes quarantined by any process, such
+// as a worker, checking the database every interval until ctx is done. Every
+// pending quote is reported once, when it is first quarantined.
+func (s Service) NotifyQuarantine(ctx context.Context, interval time.Duration, notifier Notifier) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		quotes, err := s.repository.ClaimQuarantineNotices(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.log.Warn("could not check quarantined prices", slog.Any("error", err))
+		}
+
+		for _, quote := range quotes {
+			notifier.NotifyAdmins(fmt.Sprintf("Quarantined %s = %s: %s. Accept it with POST "+
+				"/admin/quarantine/%d/accept or reject it with POST /admin/quarantine/%d/reject.",
+				quote.CurrencyName, quote.Price, quote.Reason, quote.ID, quote.ID))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListQuarantine returns the quarantined quotes with status, or all of them if
+// status is empty, newest first.
+func (s Service) ListQuarantine(ctx context.Context, status string) ([]QuarantinedQuote, error) {
+	switch status {
+	case "", QuarantinePending, QuarantineAccepted, QuarantineRejected:
+	default:
+		return nil, fmt.Errorf("error in Service's method ListQuarantine: %w, got %q", errQuarantineStatus, status)
+	}
+
+	quotes, err := s.repository.SelectQuarantine(ctx, status)
+	if err != nil {
+		return nil, fmt.Errorf("error in Service's method ListQuarantine: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// AcceptQuarantined stores a pending quote as if it had passed screening. If a
+// newer price was stored meanwhile, the quote only goes to history and min/max.
+// The quote is resolved and stored in one transaction, so it is stored once or not at all.
+func (s Service) AcceptQuarantined(ctx context.Context, id int64) (QuarantinedQuote, error) {
+	if _, err := s.pendingQuarantined(ctx, id); err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Service's method AcceptQuarantined: %w", err)
+	}
+
+	var (
+		quote      QuarantinedQuote
+		currencies []Currency
+		extremes   []NewExtreme
+	)
+
+	err := s.repository.InTx(ctx, func(repository RepositoryInterface) error {
+		tx := s.withRepository(repository)
+
+		var err error
+
+		// Resolving first locks the quote, which a repeated suspicious price may have updated.
+		if quote, err = tx.resolveQuarantined(ctx, id, QuarantineAccepted); err != nil {
+			return err
+		}
+
+		current, err := repository.SelectCurrency(ctx, quote.CurrencyName)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err //nolint:wrapcheck
+		}
+
+		if current == nil || quote.QuotedAt.After(current.CurrencyQuotedAt) {
+			currencies, extremes, err = tx.insertCurrencies(ctx, map[string]Quote{
+				quote.CurrencyName: {Price: quote.Price.String(), Time: quote.QuotedAt},
+			}, ingestTime())
+
+			return err
+		}
+
+		_, err = tx.insertHistory(ctx, []HistoryRecord{{
+			CurrencyName:  quote.CurrencyName,
+			CurrencyPrice: quote.Price,
+			CreatedAt:     quote.QuotedAt,
+			IngestedAt:    ingestTime(),
+		}})
+
+		return err
+	})
+	if err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Service's method AcceptQuarantined: %w", err)
+	}
+
+	if currencies != nil {
+		s.publishCurrencies(ctx, currencies, extremes)
+	} else {
+		s.invalidateCache()
+	}
+
+	return quote, nil
+}
+
+// RejectQuarantined discards a pending quote.
+func (s Service) RejectQuarantined(ctx context.Context, id int64) (QuarantinedQuote, error) {
+	if _, err := s.pendingQuarantined(ctx, id); err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Service's method RejectQuarantined: %w", err)
+	}
+
+	return s.resolveQuarantined(ctx, id, QuarantineRejected)
+}
+
+func (s Service) pendingQuarantined(ctx context.Context, id int64) (QuarantinedQuote, error) {
+	quote, err := s.repository.SelectQuarantinedQuote(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return QuarantinedQuote{}, fmt.Errorf("%w: %d", errQuarantineNotFound, id)
+	}
+
+	if err != nil {
+		return QuarantinedQuote{}, err //nolint:wrapcheck
+	}
+
+	if quote.Status != QuarantinePending {
+		return QuarantinedQuote{}, fmt.Errorf("%w: %d is %s", errQuarantineResolved, id, quote.Status)
+	}
+
+	return quote, nil
+}
+
+func (s Service) resolveQuarantined(ctx context.Context, id int64, status string) (QuarantinedQuote, error) {
+	quote, err := s.repository.ResolveQuarantine(ctx, id, status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return QuarantinedQuote{}, fmt.Errorf("error in Service's method resolveQuarantined: %w: %d",
+			errQuarantineResolved, id)
+	}
+
+	if err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Service's method resolveQuarantined: %w", err)
+	}
+
+	return quote, nil
+}
+
+// screenQuotes quarantines the quotes that look like glitches against recent
+// history and returns the others. If history cannot be read, quotes pass.
+func (s Service) screenQuotes(ctx context.Context, quotes map[string]Quote, ingested time.Time) map[string]Quote {
+	conf := s.Config()
+	if conf == nil || !conf.Anomaly.Enabled {
+		return quotes
+	}
+
+	screened := make(map[string]Quote, len(quotes))
+
+	for name, quote := range quotes {
+		// Prices that do not parse are reported by getCurrentPrice.
+		price, err := decimal.NewFromString(quote.Price)
+		if err != nil {
+			screened[name] = quote
+
+			continue
+		}
+
+		history, err := s.repository.SelectLatestHistory(ctx, name, conf.Anomaly.Window)
+		if err != nil {
+			s.log.Warn("could not screen price", slog.String("currency", name), slog.Any("error", err))
+
+			screened[name] = quote
+
+			continue
+		}
+
+		reference, reason, suspicious := detectAnomaly(price, history, conf.Anomaly)
+		if !suspicious {
+			screened[name] = quote
+
+			continue
+		}
+
+		quoted := ingested
+		if !quote.Time.IsZero() {
+			quoted = quote.Time.UTC().Truncate(time.Microsecond)
+		}
+
+		s.quarantine(ctx, QuarantinedQuote{
+			CurrencyName: name,
+			Price:        s.roundPrice(name, price),
+			Reference:    reference,
+			Reason:       reason,
+			QuotedAt:     quoted,
+			ReceivedAt:   ingested,
+			Status:       QuarantinePending,
+		})
+	}
+
+	return screened
+}
+
+// quarantine stores a suspicious quote, which NotifyQuarantine reports. A quote
+// that cannot be stored is dropped rather than let through. Once anomaly.confirmAfter
+// consistent suspicious prices came in a row, the price has most likely moved for
+// real, so the quote is accepted as the new level instead of freezing the rates.
+func (s Service) quarantine(ctx context.Context, quote QuarantinedQuote) {
+	observeQuarantine(quote.CurrencyName)
+
+	conf := s.Config().Anomaly
+
+	stored, err := s.repository.InsertQuarantine(ctx, quote, conf.MaxJumpPercent)
+	if err != nil {
+		s.log.Error("could not quarantine suspicious price, dropping it", slog.String("currency", quote.CurrencyName),
+			slog.String("price", quote.Price.String()), slog.Any("error", err))
+
+		return
+	}
+
+	s.log.Warn("quarantined suspicious price", slog.Int64("id", stored.ID), slog.String("currency", quote.CurrencyName),
+		slog.String("price", quote.Price.String()), slog.String("reason", quote.Reason),
+		slog.Int("occurrences", stored.Occurrences))
+
+	if conf.ConfirmAfter <= 0 || stored.Occurrences < conf.ConfirmAfter {
+		return
+	}
+
+	if _, err := s.AcceptQuarantined(ctx, stored.ID); err != nil {
+		s.log.Error("could not accept sustained price level", slog.Int64("id", stored.ID),
+			slog.String("currency", quote.CurrencyName), slog.Any("error", err))
+
+		return
+	}
+
+	s.log.Warn("accepted sustained price level", slog.Int64("id", stored.ID),
+		slog.String("currency", quote.CurrencyName), slog.String("price", quote.Price.String()),
+		slog.Int("occurrences", stored.Occurrences))
+}
+
+// detectAnomaly compares price with history, oldest first. The reference is the
+// EMA of history with a period of half its length. Without two prices of
+// history nothing is suspicious.
+func detectAnomaly(
+	price decimal.Decimal, history []HistoryRecord, conf config.Anomaly,
+) (decimal.Decimal, string, bool) {
+	if len(history) < 2 {
+		return decimal.Zero, "", false
+	}
+
+	prices := make([]float64, 0, len(history))
+	for _, record := range history {
+		prices = append(prices, record.CurrencyPrice.InexactFloat64())
+	}
+
+	current := price.InexactFloat64()
+	averages := ema(prices, max(2, len(prices)/2))
+	average := averages[len(averages)-1]
+	reference := decimal.NewFromFloat(average)
+
+	if conf.MaxJumpPercent > 0 && average != 0 {
+		if jump := math.Abs(current-average) / math.Abs(average) * 100; jump > conf.MaxJumpPercent {
+			return reference, fmt.Sprintf("%.1f%% away from the recent average %s", jump, reference), true
+		}
+	}
+
+	if conf.ZScore > 0 {
+		var sum float64
+		for _, value := range prices {
+			sum += value
+		}
+
+		mean := sum / float64(len(prices))
+
+		if deviation := sampleStdDev(prices, mean); deviation > 0 {
+			if score := math.Abs(current-mean) / deviation; score > conf.ZScore {
+				return reference, fmt.Sprintf("%.1f standard deviations from the recent mean %s",
+					score, decimal.NewFromFloat(mean)), true
+			}
+		}
+	}
+
+	return reference, "", false
+}
@@ -0,0 +1,237 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func historyOf(prices ...string) []HistoryRecord {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := make([]HistoryRecord, 0, len(prices))
+
+	for i, price := range prices {
+		history = append(history, HistoryRecord{
+			CurrencyName:  "BTC",
+			CurrencyPrice: decimal.RequireFromString(price),
+			CreatedAt:     start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+
+	return history
+}
+
+func TestDetectAnomaly(t *testing.T) {
+	t.Parallel()
+
+	steady := historyOf("100", "101", "99", "100", "102", "98", "100", "101")
+
+	tests := []struct {
+		name    string
+		price   string
+		history []HistoryRecord
+		conf    config.Anomaly
+		want    bool
+	}{
+		{"normal tick", "101", steady, config.Anomaly{MaxJumpPercent: 50}, false},
+		{"jump", "1000", steady, config.Anomaly{MaxJumpPercent: 50}, true},
+		{"drop to zero", "0", steady, config.Anomaly{MaxJumpPercent: 50}, true},
+		{"jump check disabled", "1000", steady, config.Anomaly{}, false},
+		{"z-score", "110", steady, config.Anomaly{MaxJumpPercent: 50, ZScore: 4}, true},
+		{"z-score within bounds", "103", steady, config.Anomaly{ZScore: 4}, false},
+		{"flat history has no deviation", "101", historyOf("100", "100", "100"), config.Anomaly{ZScore: 1}, false},
+		{"too little history", "1000", historyOf("100"), config.Anomaly{MaxJumpPercent: 50}, false},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, reason, got := detectAnomaly(decimal.RequireFromString(testCase.price), testCase.history, testCase.conf)
+			assert.Equal(t, testCase.want, got, reason)
+			assert.Equal(t, testCase.want, reason != "")
+		})
+	}
+}
+
+func TestStoreCurrenciesQuarantinesAnomalies(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectLatestHistory", mock.Anything, "BTC", 20).Return(historyOf("100", "101", "99"), nil)
+	repo.On("SelectLatestHistory", mock.Anything, "ETH", 20).Return(historyOf("10", "11", "10"), nil)
+	repo.On("SelectCurrency", mock.Anything, "ETH").Return((*Currency)(nil), ErrNoCurrencies)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertQuarantine", mock.Anything, mock.MatchedBy(func(quote QuarantinedQuote) bool {
+		return quote.CurrencyName == "BTC" && quote.Price.Equal(decimal.NewFromInt(1000)) &&
+			quote.Status == QuarantinePending && quote.Reason != ""
+	}), 50.0).Return(QuarantinedQuote{ID: 7, Occurrences: 1}, nil)
+
+	conf := config.Default()
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	currencies, err := svc.storeCurrencies(context.Background(), map[string]Quote{
+		"BTC": {Price: "1000"},
+		"ETH": {Price: "10.5"},
+	})
+	require.NoError(t, err)
+	require.Len(t, currencies, 1)
+	assert.Equal(t, "ETH", currencies[0].CurrencyName)
+	repo.AssertNumberOfCalls(t, "InsertQuarantine", 1)
+}
+
+func TestStoreCurrenciesAcceptsSustainedShift(t *testing.T) {
+	t.Parallel()
+
+	quoted := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pending := QuarantinedQuote{
+		ID: 7, CurrencyName: "BTC", Price: decimal.NewFromInt(200), QuotedAt: quoted, Status: QuarantinePending,
+	}
+	accepted := pending
+	accepted.Status = QuarantineAccepted
+
+	repo := new(MockRepo)
+	repo.On("SelectLatestHistory", mock.Anything, "BTC", 20).Return(historyOf("100", "101", "99"), nil).Times(3)
+	// Accepting the quote rebaselines the history that later prices are screened against.
+	repo.On("SelectLatestHistory", mock.Anything, "BTC", 20).Return(historyOf("200"), nil)
+
+	for occurrences := 1; occurrences <= 3; occurrences++ {
+		repo.On("InsertQuarantine", mock.Anything, mock.Anything, 50.0).Return(QuarantinedQuote{
+			ID: 7, CurrencyName: "BTC", Occurrences: occurrences,
+		}, nil).Once()
+	}
+
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(7)).Return(pending, nil)
+	repo.On("ResolveQuarantine", mock.Anything, int64(7), QuarantineAccepted).Return(accepted, nil)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName: "BTC", CurrencyQuotedAt: quoted.Add(-time.Hour),
+	}, nil)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency(nil), nil)
+
+	conf := config.Default()
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	for range 3 {
+		_, err := svc.storeCurrencies(context.Background(), map[string]Quote{"BTC": {Price: "200"}})
+		require.NoError(t, err)
+	}
+
+	repo.AssertNumberOfCalls(t, "ResolveQuarantine", 1)
+	repo.AssertNumberOfCalls(t, "InsertCurrencies", 1)
+
+	_, err := svc.storeCurrencies(context.Background(), map[string]Quote{"BTC": {Price: "201"}})
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "InsertQuarantine", 3)
+	repo.AssertNumberOfCalls(t, "InsertCurrencies", 2)
+}
+
+func TestResolveQuarantined(t *testing.T) {
+	t.Parallel()
+
+	quoted := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	pending := QuarantinedQuote{
+		ID: 1, CurrencyName: "BTC", Price: decimal.NewFromInt(1000), QuotedAt: quoted, Status: QuarantinePending,
+	}
+	stale := QuarantinedQuote{
+		ID: 2, CurrencyName: "BTC", Price: decimal.NewFromInt(1000), QuotedAt: quoted, Status: QuarantinePending,
+	}
+	resolved := pending
+	resolved.Status = QuarantineAccepted
+
+	repo := new(MockRepo)
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(1)).Return(pending, nil)
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(2)).Return(stale, nil)
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(3)).Return(resolved, nil)
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(4)).Return(QuarantinedQuote{}, pgx.ErrNoRows)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName: "BTC", CurrencyQuotedAt: quoted.Add(-time.Hour),
+	}, nil).Once()
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName: "BTC", CurrencyQuotedAt: quoted.Add(time.Hour),
+	}, nil)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	repo.On("InsertHistory", mock.Anything, mock.Anything, mock.Anything).Return(int64(1), nil)
+	repo.On("RecomputeExtremes", mock.Anything, []string{"BTC"}).Return(nil)
+	repo.On("ResolveQuarantine", mock.Anything, int64(1), QuarantineAccepted).Return(resolved, nil)
+	repo.On("ResolveQuarantine", mock.Anything, int64(2), QuarantineAccepted).Return(stale, nil)
+	repo.On("SelectQuarantinedQuote", mock.Anything, int64(5)).Return(pending, nil)
+	repo.On("ResolveQuarantine", mock.Anything, int64(5), QuarantineAccepted).Return(QuarantinedQuote{}, pgx.ErrNoRows)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	quote, err := svc.AcceptQuarantined(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, QuarantineAccepted, quote.Status)
+	repo.AssertNumberOfCalls(t, "InsertCurrencies", 1)
+
+	_, err = svc.AcceptQuarantined(context.Background(), 2)
+	require.NoError(t, err)
+	repo.AssertNumberOfCalls(t, "InsertCurrencies", 1)
+	repo.AssertNumberOfCalls(t, "InsertHistory", 1)
+
+	// A quote resolved concurrently is not stored again.
+	_, err = svc.AcceptQuarantined(context.Background(), 5)
+	require.ErrorIs(t, err, errQuarantineResolved)
+	repo.AssertNumberOfCalls(t, "InsertCurrencies", 1)
+	repo.AssertNumberOfCalls(t, "InsertHistory", 1)
+
+	_, err = svc.RejectQuarantined(context.Background(), 3)
+	require.ErrorIs(t, err, errQuarantineResolved)
+
+	_, err = svc.RejectQuarantined(context.Background(), 4)
+	require.ErrorIs(t, err, errQuarantineNotFound)
+
+	_, err = svc.ListQuarantine(context.Background(), "unknown")
+	require.ErrorIs(t, err, errQuarantineStatus)
+}
+
+type recordingNotifier struct {
+	messages chan string
+}
+
+func (n recordingNotifier) NotifyAdmins(message string) {
+	n.messages <- message
+}
+
+func TestNotifyQuarantine(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("ClaimQuarantineNotices", mock.Anything).Return([]QuarantinedQuote{
+		{ID: 7, CurrencyName: "BTC", Price: decimal.NewFromInt(1000), Reason: "too far"},
+	}, nil).Once()
+	repo.On("ClaimQuarantineNotices", mock.Anything).Return([]QuarantinedQuote(nil), nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+	notifier := recordingNotifier{messages: make(chan string, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		svc.NotifyQuarantine(ctx, time.Millisecond, notifier)
+	}()
+
+	assert.Contains(t, <-notifier.messages, "Quarantined BTC = 1000: too far.")
+
+	cancel()
+	<-done
+
+	// Claimed quotes are reported once.
+	assert.Empty(t, notifier.messages)
+}
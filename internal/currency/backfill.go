@@ -0,0 +1,151 @@
+package currency
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const csvDateLayout = "2006-01-02"
+
+var (
+	errUnknownPair = errors.New("pair is not configured")
+	errCSVColumns  = errors.New("expected the columns date, pair, price")
+	errCSVDate     = errors.New("date must be RFC 3339 or YYYY-MM-DD")
+)
+
+// BackfillResult reports what a backfill read and how much of it was new.
+type BackfillResult struct {
+	Read       int
+	Inserted   int64
+	Currencies []string
+}
+
+// BackfillCSV imports history from CSV rows of date, pair and price, such as
+// "2024-01-31,BTCRUB,3850000.5". The date is RFC 3339 or a day (midnight UTC),
+// the pair must be one of the configured pairs, and a header row is allowed.
+func (s Service) BackfillCSV(ctx context.Context, reader io.Reader) (BackfillResult, error) {
+	records, err := s.readHistoryCSV(reader)
+	if err != nil {
+		return BackfillResult{}, fmt.Errorf("error in Service's method BackfillCSV: %w", err)
+	}
+
+	return s.storeHistory(ctx, records)
+}
+
+// storeHistory inserts records, skipping those already stored, and widens
+// min/max of the affected currencies to their history.
+func (s Service) storeHistory(ctx context.Context, records []HistoryRecord) (BackfillResult, error) {
+	result, err := s.insertHistory(ctx, records)
+	if err != nil {
+		return result, err
+	}
+
+	s.invalidateCache()
+
+	return result, nil
+}
+
+// insertHistory stores records and recomputes min/max, leaving the cache to the caller.
+func (s Service) insertHistory(ctx context.Context, records []HistoryRecord) (BackfillResult, error) {
+	result := BackfillResult{Read: len(records)}
+
+	names := make(map[string]struct{})
+	for _, record := range records {
+		names[record.CurrencyName] = struct{}{}
+	}
+
+	for name := range names {
+		result.Currencies = append(result.Currencies, name)
+	}
+
+	sort.Strings(result.Currencies)
+
+	if len(records) == 0 {
+		return result, nil
+	}
+
+	inserted, err := s.repository.InsertHistory(ctx, records, s.historyTiers(time.Now()).Raw)
+	result.Inserted = inserted
+
+	if err != nil {
+		return result, fmt.Errorf("error in Service's method insertHistory: %w", err)
+	}
+
+	if err := s.repository.RecomputeExtremes(ctx, result.Currencies); err != nil {
+		return result, fmt.Errorf("error in Service's method insertHistory: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s Service) readHistoryCSV(reader io.Reader) ([]HistoryRecord, error) {
+	pairs := make(map[string]string)
+
+	for name, pair := range s.Config().Pairs {
+		pairs[strings.ToUpper(pair)] = name
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = 3
+	csvReader.TrimLeadingSpace = true
+
+	var records []HistoryRecord
+
+	ingested := ingestTime()
+
+	for line := 1; ; line++ {
+		row, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errCSVColumns, err)
+		}
+
+		if line == 1 && strings.EqualFold(row[0], "date") {
+			continue
+		}
+
+		record, err := parseHistoryRow(row, pairs)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		record.CurrencyPrice = s.roundPrice(record.CurrencyName, record.CurrencyPrice)
+		record.IngestedAt = ingested
+
+		records = append(records, record)
+	}
+}
+
+func parseHistoryRow(row []string, pairs map[string]string) (HistoryRecord, error) {
+	created, err := time.Parse(time.RFC3339, row[0])
+	if err != nil {
+		created, err = time.Parse(csvDateLayout, row[0])
+	}
+
+	if err != nil {
+		return HistoryRecord{}, fmt.Errorf("%w, got %q", errCSVDate, row[0])
+	}
+
+	name, ok := pairs[strings.ToUpper(row[1])]
+	if !ok {
+		return HistoryRecord{}, fmt.Errorf("%w: %q", errUnknownPair, row[1])
+	}
+
+	price, err := decimal.NewFromString(row[2])
+	if err != nil {
+		return HistoryRecord{}, fmt.Errorf("price %q: %w", row[2], err)
+	}
+
+	return HistoryRecord{CurrencyName: name, CurrencyPrice: price, CreatedAt: created.UTC()}, nil
+}
@@ -0,0 +1,100 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackfillCSV(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		csv         string
+		wantRecords []HistoryRecord
+		wantErr     error
+	}{
+		{
+			name: "header, dates and timestamps",
+			csv: "date,pair,price\n" +
+				"2024-01-30,BTCRUB,3800000\n" +
+				"2024-01-31T12:00:00+03:00, ethrub, 210000.5\n",
+			wantRecords: []HistoryRecord{
+				{
+					CurrencyName:  "BTC",
+					CurrencyPrice: decimal.RequireFromString("3800000"),
+					CreatedAt:     time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					CurrencyName:  "ETH",
+					CurrencyPrice: decimal.RequireFromString("210000.5"),
+					CreatedAt:     time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			name:    "unknown pair",
+			csv:     "2024-01-30,DOGERUB,10\n",
+			wantErr: errUnknownPair,
+		},
+		{
+			name:    "bad date",
+			csv:     "30.01.2024,BTCRUB,10\n",
+			wantErr: errCSVDate,
+		},
+		{
+			name:    "missing column",
+			csv:     "2024-01-30,BTCRUB\n",
+			wantErr: errCSVColumns,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := new(MockRepo)
+			// Every record is stamped with the time of the backfill.
+			repo.On("InsertHistory", mock.Anything, mock.MatchedBy(func(records []HistoryRecord) bool {
+				got := slices.Clone(records)
+				for i := range got {
+					if got[i].IngestedAt.IsZero() {
+						return false
+					}
+
+					got[i].IngestedAt = time.Time{}
+				}
+
+				return assert.ObjectsAreEqual(testCase.wantRecords, got)
+			}), mock.Anything).Return(int64(1), nil)
+			repo.On("RecomputeExtremes", mock.Anything, []string{"BTC", "ETH"}).Return(nil)
+
+			conf := config.Default()
+			conf.Pairs = map[string]string{"BTC": "BTCRUB", "ETH": "ETHRUB"}
+			svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+			result, err := svc.BackfillCSV(context.Background(), strings.NewReader(testCase.csv))
+			if testCase.wantErr != nil {
+				require.ErrorIs(t, err, testCase.wantErr)
+				repo.AssertNotCalled(t, "InsertHistory", mock.Anything, mock.Anything, mock.Anything)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, BackfillResult{Read: 2, Inserted: 1, Currencies: []string{"BTC", "ETH"}}, result)
+			repo.AssertExpectations(t)
+		})
+	}
+}
@@ -2,17 +2,23 @@ package currency
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/telebot.v3"
 )
 
-func getCurrencies(service *Service) (string, error) {
-	var message string
+// botTimeLayout is how the bot shows quote times, in the chat's time zone.
+const botTimeLayout = "2006-01-02 15:04 MST"
 
+func getCurrencies(service *Service, location *time.Location) (string, error) {
 	currencies, err := service.GetCurrencies(context.Background())
 	if err != nil {
 		log.Printf("error in bot handle /rates: %v", err)
@@ -20,28 +26,113 @@ func getCurrencies(service *Service) (string, error) {
 		return "", fmt.Errorf("error im method getCurrencies: %w", err)
 	}
 
+	return formatRates(currencies, location), nil
+}
+
+// formatRates lists the prices one per line, with the time they were quoted in location.
+func formatRates(currencies []Currency, location *time.Location) string {
+	lines := make([]string, 0, len(currencies))
+
 	for _, currency := range currencies {
-		message += fmt.Sprintf("%s = %.2f ", currency.CurrencyName, currency.CurrencyPrice)
+		lines = append(lines, formatRate(currency, location))
 	}
 
-	return message, nil
+	return strings.Join(lines, "\n")
 }
 
-func BotRun(key string, service *Service) {
+// formatRate shows a price and, if they were loaded, its min/max in every window.
+func formatRate(currency Currency, location *time.Location) string {
+	message := fmt.Sprintf("%s = %s at %s", currency.CurrencyName, currency.CurrencyPrice,
+		currency.CurrencyQuotedAt.In(location).Format(botTimeLayout))
+
+	for _, window := range currency.CurrencyExtremes {
+		message += fmt.Sprintf("\n%s: min %s at %s, max %s at %s", window.Window,
+			window.Min.Price, window.Min.At.In(location).Format(botTimeLayout),
+			window.Max.Price, window.Max.At.In(location).Format(botTimeLayout))
+	}
+
+	return message
+}
+
+var (
+	errBotNotRunning = errors.New("bot poller is not running")
+	errBotPolling    = errors.New("last getUpdates call failed")
+	errBotStatus     = errors.New("unexpected status")
+)
+
+// Bot is the Telegram front end of Service.
+type Bot struct {
+	bot     *telebot.Bot
+	service *Service
+	running atomic.Bool
+	polls   *pollTracker
+	poller  telebot.Poller
+}
+
+// startedPoller closes started once polling begins. telebot's Start sets up
+// what Stop uses before it starts the poller, so Stop is safe from then on.
+type startedPoller struct {
+	next    telebot.Poller
+	started chan struct{}
+}
+
+func (p startedPoller) Poll(bot *telebot.Bot, updates chan telebot.Update, stop chan struct{}) {
+	close(p.started)
+	p.next.Poll(bot, updates, stop)
+}
+
+// pollTracker records the outcome of the poller's getUpdates calls, which
+// telebot otherwise only reports in verbose mode.
+type pollTracker struct {
+	next    http.RoundTripper
+	mu      sync.Mutex
+	lastErr error
+}
+
+func (p *pollTracker) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := p.next.RoundTrip(request)
+
+	if strings.HasSuffix(request.URL.Path, "/getUpdates") {
+		pollErr := err
+		if err == nil && response.StatusCode != http.StatusOK {
+			pollErr = fmt.Errorf("%w: %d", errBotStatus, response.StatusCode)
+		}
+
+		p.mu.Lock()
+		p.lastErr = pollErr
+		p.mu.Unlock()
+	}
+
+	return response, err //nolint:wrapcheck
+}
+
+func (p *pollTracker) err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lastErr
+}
+
+//nolint:funlen
+func NewBot(key string, service *Service) (*Bot, error) {
 	autoChan := make(chan struct{})
 
 	var timeout time.Duration
 
 	timePoller := 10
+	timeClient := 60
+
+	polls := &pollTracker{next: http.DefaultTransport}
 
 	pref := telebot.Settings{
 		Token:  key,
 		Poller: &telebot.LongPoller{Timeout: time.Duration(timePoller) * time.Second},
+		Client: &http.Client{Timeout: time.Duration(timeClient) * time.Second, Transport: polls},
 	}
 
 	bot, err := telebot.NewBot(pref)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("error in NewBot: %w", err)
 	}
 
 	bot.Handle("/start", func(ctx telebot.Context) error {
@@ -49,13 +140,13 @@ func BotRun(key string, service *Service) {
 			without parameters will display the BTC and ETH rates. 
 		The /rates command with the BTC or ETH parameter will display the rate of the selected currency. 
 		The /start_auto {minutes} command will automatically send the exchange rate. 
-			The /stop_auto command will override /start_auto.`)
-	})
+			The /stop_auto command will override /start_auto.
+		The /timezone {zone} command, e.g. /timezone Europe/Moscow, sets the time zone of the times shown.`)
+	}, CountCommand("/start"))
 
 	bot.Handle("/rates", func(ctx telebot.Context) error {
-		var message string
-
 		tag := ctx.Args()
+		location := service.ChatLocation(context.Background(), ctx.Chat().ID)
 
 		if len(tag) == 0 {
 			currencies, err := service.GetCurrencies(context.Background())
@@ -65,11 +156,7 @@ func BotRun(key string, service *Service) {
 				return ctx.Send("Something wrong. Please try again later.")
 			}
 
-			for _, currency := range currencies {
-				message += fmt.Sprintf("%s = %.2f ", currency.CurrencyName, currency.CurrencyPrice)
-			}
-
-			return ctx.Send(message)
+			return ctx.Send(formatRates(currencies, location))
 		}
 
 		if len(tag) == 1 {
@@ -78,13 +165,11 @@ func BotRun(key string, service *Service) {
 				return ctx.Send("Something wrong. Please try again later.")
 			}
 
-			message = fmt.Sprintf("%s = %.2f", currency.CurrencyName, currency.CurrencyPrice)
-
-			return ctx.Send(message)
+			return ctx.Send(formatRate(*currency, location))
 		}
 
 		return ctx.Send("wrong arguments count")
-	})
+	}, CountCommand("/rates"))
 
 	bot.Handle("/start_auto", func(ctx telebot.Context) error {
 		tag := ctx.Args()
@@ -102,7 +187,7 @@ func BotRun(key string, service *Service) {
 					return nil
 
 				case <-time.After(timeout):
-					message, err := getCurrencies(service)
+					message, err := getCurrencies(service, service.ChatLocation(context.Background(), ctx.Chat().ID))
 					if err != nil {
 						log.Printf("error in getCurrencies: %v", err)
 					}
@@ -116,7 +201,32 @@ func BotRun(key string, service *Service) {
 		} else {
 			return ctx.Send("Invalid parametrs count.")
 		}
-	})
+	}, CountCommand("/start_auto"))
+
+	bot.Handle("/timezone", func(ctx telebot.Context) error {
+		tag := ctx.Args()
+
+		if len(tag) == 0 {
+			return ctx.Send("Times are shown in " + service.ChatLocation(context.Background(), ctx.Chat().ID).String() + ".")
+		}
+
+		if len(tag) != 1 {
+			return ctx.Send("Invalid parametrs count.")
+		}
+
+		location, err := service.SetChatTimezone(context.Background(), ctx.Chat().ID, tag[0])
+		if errors.Is(err, errTimezone) {
+			return ctx.Send("Unknown time zone. Use a name such as Europe/Moscow or UTC.")
+		}
+
+		if err != nil {
+			log.Printf("error in bot handle /timezone: %v", err)
+
+			return ctx.Send("Something wrong. Please try again later.")
+		}
+
+		return ctx.Send("Times are now shown in " + location.String() + ".")
+	}, CountCommand("/timezone"))
 
 	bot.Handle("/stop_auto", func(ctx telebot.Context) error {
 		go func(chan struct{}) {
@@ -124,7 +234,101 @@ func BotRun(key string, service *Service) {
 		}(autoChan)
 
 		return ctx.Send("Autosender deactivated.")
-	})
+	}, CountCommand("/stop_auto"))
+
+	return &Bot{bot: bot, service: service, polls: polls, poller: bot.Poller}, nil
+}
+
+// Run polls Telegram for updates until ctx is done and returns once polling
+// stopped. Polling starts before Run waits for ctx, so a ctx that is already
+// done still stops the poller; there is no window in which a stop is lost.
+func (b *Bot) Run(ctx context.Context) {
+	b.running.Store(true)
+	defer b.running.Store(false)
+
+	started, done := make(chan struct{}), make(chan struct{})
+	b.bot.Poller = startedPoller{next: b.poller, started: started}
+
+	go func() {
+		defer close(done)
+
+		b.bot.Start()
+	}()
+
+	<-ctx.Done()
+	<-started
+	b.bot.Stop()
+	<-done
+}
+
+// Check reports whether the poller is running and its last request succeeded.
+func (b *Bot) Check(_ context.Context) error {
+	if !b.running.Load() {
+		return errBotNotRunning
+	}
+
+	if err := b.polls.err(); err != nil {
+		return fmt.Errorf("%w: %w", errBotPolling, err)
+	}
+
+	return nil
+}
+
+// WatchEvents tells the admin chats when fetching rates starts failing and when
+// it recovers, until ctx is done. It only sees the fetches of this process.
+func (b *Bot) WatchEvents(ctx context.Context) {
+	events, unsubscribe := Subscribe[Event](b.service.Events())
+	defer unsubscribe()
 
-	bot.Start()
+	failing := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if message, changed := fetchStatusMessage(event, &failing); changed {
+				b.NotifyAdmins(message)
+			}
+		}
+	}
+}
+
+// fetchStatusMessage describes the first failure after a success and the first
+// success after failures, and tracks which of them was last seen in failing.
+func fetchStatusMessage(event Event, failing *bool) (string, bool) {
+	switch event := event.(type) {
+	case FetchFailed:
+		if *failing {
+			return "", false
+		}
+
+		*failing = true
+
+		// The error is left to the log, which redacts secrets such as a key in the provider URL.
+		return fmt.Sprintf("Fetching rates from %s failed, see the log for details.", event.Provider), true
+	case RateUpdated:
+		if !*failing {
+			return "", false
+		}
+
+		*failing = false
+
+		return "Fetching rates recovered.", true
+	}
+
+	return "", false
+}
+
+// NotifyAdmins sends message to every chat in the current adminChatIds.
+func (b *Bot) NotifyAdmins(message string) {
+	for _, chatID := range b.service.Config().AdminChatIDs {
+		if _, err := b.bot.Send(telebot.ChatID(chatID), message); err != nil {
+			log.Printf("error notifying admin chat %d: %v", chatID, err)
+		}
+	}
 }
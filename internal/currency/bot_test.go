@@ -0,0 +1,47 @@
+package currency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/telebot.v3"
+)
+
+// stoppablePoller receives no updates and returns when told to stop.
+type stoppablePoller struct{}
+
+func (stoppablePoller) Poll(_ *telebot.Bot, _ chan telebot.Update, stop chan struct{}) {
+	<-stop
+}
+
+func TestBotRunStopsWhenLeadershipEndsEarly(t *testing.T) {
+	t.Parallel()
+
+	telegram, err := telebot.NewBot(telebot.Settings{Offline: true, Poller: stoppablePoller{}})
+	require.NoError(t, err)
+
+	bot := &Bot{bot: telegram, polls: &pollTracker{}, poller: telegram.Poller}
+
+	// Leadership may end before polling has even started.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		bot.Run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after its context was done")
+	}
+
+	assert.ErrorIs(t, bot.Check(context.Background()), errBotNotRunning)
+}
@@ -0,0 +1,131 @@
+package currency
+
+import (
+	"sync"
+)
+
+const (
+	updatesBacklogSize    = 64
+	subscriberChannelSize = 16
+)
+
+// RatesUpdate is a set of prices stored by a single CurrencyMonitor run.
+// ID grows monotonically for the lifetime of the process.
+type RatesUpdate struct {
+	ID         uint64
+	Currencies []Currency
+}
+
+// Broadcaster fans out rate updates to subscribers and keeps a short backlog
+// so that reconnecting clients can catch up on what they missed.
+type Broadcaster struct {
+	mu          sync.Mutex
+	closed      bool
+	lastID      uint64
+	backlog     []RatesUpdate
+	subscribers map[chan RatesUpdate]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		backlog:     make([]RatesUpdate, 0, updatesBacklogSize),
+		subscribers: make(map[chan RatesUpdate]struct{}),
+	}
+}
+
+// Publish assigns the next ID to currencies and delivers them to every subscriber.
+// A subscriber whose buffer is full is dropped and its channel closed, so a slow
+// reader never blocks CurrencyMonitor; it can resubscribe from the last ID it saw.
+func (b *Broadcaster) Publish(currencies []Currency) RatesUpdate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	update := RatesUpdate{ID: b.lastID, Currencies: currencies}
+
+	if len(b.backlog) == updatesBacklogSize {
+		b.backlog = append(b.backlog[:0], b.backlog[1:]...)
+	}
+
+	b.backlog = append(b.backlog, update)
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- update:
+		default:
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return update
+}
+
+// Latest returns the last published update, if any is still in the backlog.
+func (b *Broadcaster) Latest() (RatesUpdate, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.backlog) == 0 {
+		return RatesUpdate{}, false
+	}
+
+	return b.backlog[len(b.backlog)-1], true
+}
+
+// Subscribe registers a new subscriber and returns the updates published after lastID
+// that are still in the backlog. An ID the broadcaster has never issued (for example
+// one from before a restart) replays the whole backlog. The returned function
+// unsubscribes and must be called once the caller stops reading.
+func (b *Broadcaster) Subscribe(lastID uint64) (<-chan RatesUpdate, []RatesUpdate, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscriber := make(chan RatesUpdate, subscriberChannelSize)
+
+	if b.closed {
+		close(subscriber)
+
+		return subscriber, nil, func() {}
+	}
+
+	b.subscribers[subscriber] = struct{}{}
+
+	if lastID > b.lastID {
+		lastID = 0
+	}
+
+	missed := make([]RatesUpdate, 0, len(b.backlog))
+
+	for _, update := range b.backlog {
+		if update.ID > lastID {
+			missed = append(missed, update)
+		}
+	}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[subscriber]; ok {
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+
+	return subscriber, missed, unsubscribe
+}
+
+// Close ends every subscription and makes later ones return a closed channel.
+// It is used on shutdown so that streaming handlers return.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for subscriber := range b.subscribers {
+		delete(b.subscribers, subscriber)
+		close(subscriber)
+	}
+}
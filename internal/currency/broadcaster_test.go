@@ -0,0 +1,105 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcasterSubscribe(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		published int
+		lastID    uint64
+		wantIDs   []uint64
+	}{
+		{
+			name:      "resume after last seen",
+			published: 3,
+			lastID:    1,
+			wantIDs:   []uint64{2, 3},
+		},
+		{
+			name:      "up to date",
+			published: 3,
+			lastID:    3,
+			wantIDs:   []uint64{},
+		},
+		{
+			name:      "unknown id replays backlog",
+			published: 2,
+			lastID:    42,
+			wantIDs:   []uint64{1, 2},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			broadcaster := NewBroadcaster()
+
+			for range testCase.published {
+				broadcaster.Publish([]Currency{{CurrencyName: "BTC"}})
+			}
+
+			_, missed, unsubscribe := broadcaster.Subscribe(testCase.lastID)
+			defer unsubscribe()
+
+			gotIDs := make([]uint64, 0, len(missed))
+			for _, update := range missed {
+				gotIDs = append(gotIDs, update.ID)
+			}
+
+			assert.Equal(t, testCase.wantIDs, gotIDs)
+		})
+	}
+}
+
+func TestBroadcasterDropsSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	broadcaster := NewBroadcaster()
+
+	updates, _, unsubscribe := broadcaster.Subscribe(0)
+	defer unsubscribe()
+
+	for range subscriberChannelSize + 1 {
+		broadcaster.Publish([]Currency{{CurrencyName: "ETH"}})
+	}
+
+	received := 0
+	for range updates {
+		received++
+	}
+
+	require.Equal(t, subscriberChannelSize, received)
+}
+
+func TestBroadcasterClose(t *testing.T) {
+	t.Parallel()
+
+	broadcaster := NewBroadcaster()
+	broadcaster.Publish([]Currency{{CurrencyName: "BTC"}})
+
+	updates, _, unsubscribe := broadcaster.Subscribe(0)
+
+	broadcaster.Close()
+
+	_, ok := <-updates
+	require.False(t, ok, "subscriptions end on close")
+
+	// Unsubscribing after close and publishing to no one must not panic.
+	unsubscribe()
+	broadcaster.Publish([]Currency{{CurrencyName: "BTC"}})
+
+	later, missed, unsubscribeLater := broadcaster.Subscribe(0)
+	defer unsubscribeLater()
+
+	_, ok = <-later
+	require.False(t, ok, "subscribing after close returns a closed channel")
+	require.Empty(t, missed)
+}
@@ -0,0 +1,215 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cacheResultHit   = "hit"
+	cacheResultStale = "stale"
+	cacheResultMiss  = "miss"
+
+	cacheRefreshUpdate  = "update"
+	cacheRefreshExpired = "expired"
+	cacheRefreshWatch   = "watch"
+
+	// cacheRefreshTimeout bounds a reload of an expired cache in the background.
+	cacheRefreshTimeout = 10 * time.Second
+)
+
+// readCache keeps the stored currencies so that reads do not wait for the
+// database. It is reloaded as a whole after every SetCurrencies, dropped after
+// other writes through the Service, and reloaded when it is older than cacheTtl,
+// which covers writes by other processes. An expired cache is still served while
+// it is reloaded in the background. Loads are serialized, so a slow load cannot
+// replace a newer one.
+type readCache struct {
+	snapshot   atomic.Pointer[cacheSnapshot]
+	mu         sync.Mutex
+	refreshing atomic.Bool
+}
+
+type cacheSnapshot struct {
+	currencies []Currency
+	byName     map[string]int
+	loaded     time.Time
+	// extremes are the windowed min/max prices by currency name, loaded on first use.
+	extremes sync.Map
+}
+
+func newCacheSnapshot(currencies []Currency, loaded time.Time) *cacheSnapshot {
+	snapshot := &cacheSnapshot{
+		currencies: currencies,
+		byName:     make(map[string]int, len(currencies)),
+		loaded:     loaded,
+	}
+
+	for i, currency := range currencies {
+		snapshot.byName[currency.CurrencyName] = i
+	}
+
+	return snapshot
+}
+
+func (s *cacheSnapshot) fresh(ttl time.Duration, now time.Time) bool {
+	return s != nil && now.Sub(s.loaded) < ttl
+}
+
+// currency returns a copy of the named currency, so that callers can change it.
+func (s *cacheSnapshot) currency(name string) (*Currency, bool) {
+	i, ok := s.byName[name]
+	if !ok {
+		return nil, false
+	}
+
+	currency := s.currencies[i]
+
+	return &currency, true
+}
+
+func (s *cacheSnapshot) cachedExtremes(name string) ([]WindowExtremes, bool) {
+	extremes, ok := s.extremes.Load(name)
+	if !ok {
+		return nil, false
+	}
+
+	return slices.Clone(extremes.([]WindowExtremes)), true //nolint:forcetypeassert
+}
+
+// cacheTTL returns how long cached currencies are served, or 0 if the cache is disabled.
+func (s Service) cacheTTL() time.Duration {
+	conf := s.Config()
+	if conf == nil {
+		return 0
+	}
+
+	return time.Duration(conf.CacheTTL) * time.Second
+}
+
+// cachedSnapshot returns the cached snapshot, or nil if the cache is disabled.
+// An expired snapshot is returned as well and reloaded in the background; only
+// when there is none does the read wait for a load.
+func (s Service) cachedSnapshot(ctx context.Context) (*cacheSnapshot, error) {
+	ttl := s.cacheTTL()
+	if ttl <= 0 {
+		return nil, nil
+	}
+
+	snapshot := s.cache.snapshot.Load()
+	if snapshot.fresh(ttl, time.Now()) {
+		observeCache(cacheResultHit)
+
+		return snapshot, nil
+	}
+
+	if snapshot != nil {
+		observeCache(cacheResultStale)
+		s.reloadExpired(ctx, ttl)
+
+		return snapshot, nil
+	}
+
+	observeCache(cacheResultMiss)
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	// Another request may have loaded it while this one waited.
+	if snapshot := s.cache.snapshot.Load(); snapshot != nil {
+		return snapshot, nil
+	}
+
+	return s.loadSnapshot(ctx, cacheRefreshExpired)
+}
+
+// reloadExpired reloads an expired cache in the background, one load at a time.
+// If the load fails, the expired snapshot is kept and a later read tries again.
+func (s Service) reloadExpired(ctx context.Context, ttl time.Duration) {
+	if !s.cache.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		defer s.cache.refreshing.Store(false)
+
+		ctx, cancel := context.WithTimeout(ctx, cacheRefreshTimeout)
+		defer cancel()
+
+		s.cache.mu.Lock()
+		defer s.cache.mu.Unlock()
+
+		// A write may have refreshed it meanwhile.
+		if s.cache.snapshot.Load().fresh(ttl, time.Now()) {
+			return
+		}
+
+		if _, err := s.loadSnapshot(ctx, cacheRefreshExpired); err != nil {
+			s.log.Warn("could not reload expired cached currencies", slog.Any("error", err))
+		}
+	}()
+}
+
+// refreshCache reloads the cache after a write. If that fails, the cache is
+// dropped, so that the next read goes to the database.
+func (s Service) refreshCache(ctx context.Context) {
+	if s.cacheTTL() <= 0 {
+		return
+	}
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	if _, err := s.loadSnapshot(ctx, cacheRefreshUpdate); err != nil {
+		s.cache.snapshot.Store(nil)
+		s.log.Warn("could not refresh cached currencies", slog.Any("error", err))
+	}
+}
+
+// invalidateCache drops the cache, so that the next read loads it from the database.
+func (s Service) invalidateCache() {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	s.cache.snapshot.Store(nil)
+}
+
+// setCache replaces the cache with currencies read from the database at loaded,
+// unless the cache was loaded later.
+func (s Service) setCache(currencies []Currency, loaded time.Time, reason string) {
+	if s.cacheTTL() <= 0 {
+		return
+	}
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+
+	if current := s.cache.snapshot.Load(); current != nil && !current.loaded.Before(loaded) {
+		return
+	}
+
+	s.cache.snapshot.Store(newCacheSnapshot(currencies, loaded))
+	observeCacheRefresh(reason)
+}
+
+// loadSnapshot must be called with the cache's mutex held.
+func (s Service) loadSnapshot(ctx context.Context, reason string) (*cacheSnapshot, error) {
+	loaded := time.Now()
+
+	currencies, err := s.repository.SelectAllCurrencies(ctx)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	snapshot := newCacheSnapshot(currencies, loaded)
+	s.cache.snapshot.Store(snapshot)
+	observeCacheRefresh(reason)
+
+	return snapshot, nil
+}
@@ -0,0 +1,117 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCache(t *testing.T) {
+	t.Parallel()
+
+	stored := []Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(100)}}
+	updated := []Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(101)}}
+	extremes := []WindowExtremes{{Window: "24h"}}
+
+	repo := new(MockRepo)
+	repo.On("SelectAllCurrencies", mock.Anything).Return(stored, nil).Once()
+	repo.On("SelectAllCurrencies", mock.Anything).Return(updated, nil)
+	repo.On("SelectExtremes", mock.Anything, "BTC", mock.Anything).Return(extremes, nil)
+	repo.On("SelectCurrency", mock.Anything, "ETH").Return((*Currency)(nil), pgx.ErrNoRows)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&stored[0], nil)
+	repo.On("SelectLatestHistory", mock.Anything, "BTC", mock.Anything).Return([]HistoryRecord(nil), nil)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+
+	conf := config.Default()
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+	ctx := context.Background()
+
+	for range 3 {
+		currencies, err := svc.GetCurrencies(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, stored, currencies)
+
+		currency, err := svc.GetCurrency(ctx, "BTC")
+		require.NoError(t, err)
+		assert.Equal(t, extremes, currency.CurrencyExtremes)
+	}
+
+	repo.AssertNumberOfCalls(t, "SelectAllCurrencies", 1)
+	repo.AssertNumberOfCalls(t, "SelectExtremes", 1)
+	repo.AssertNotCalled(t, "SelectCurrency", mock.Anything, "BTC")
+
+	_, err := svc.GetCurrency(ctx, "ETH")
+	require.ErrorIs(t, err, pgx.ErrNoRows, "a currency missing from the cache is looked up")
+
+	require.NoError(t, svc.SetCurrencies(ctx, map[string]string{"BTC": "101"}))
+
+	currencies, err := svc.GetCurrencies(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, updated, currencies, "SetCurrencies refreshes the cache")
+	repo.AssertNumberOfCalls(t, "SelectAllCurrencies", 2)
+
+	svc.cache.snapshot.Store(newCacheSnapshot(stored, time.Now().Add(-time.Hour)))
+
+	currencies, err = svc.GetCurrencies(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, stored, currencies, "an expired cache is served while it is reloaded")
+
+	assert.Eventually(t, func() bool {
+		currencies, err := svc.GetCurrencies(ctx)
+
+		return err == nil && assert.ObjectsAreEqual(updated, currencies)
+	}, 5*time.Second, time.Millisecond, "an expired cache is reloaded in the background")
+	repo.AssertNumberOfCalls(t, "SelectAllCurrencies", 3)
+}
+
+func TestReadCacheKeepsExpiredSnapshotOnError(t *testing.T) {
+	t.Parallel()
+
+	stored := []Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(100)}}
+
+	repo := new(MockRepo)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency(nil), errFetch)
+
+	conf := config.Default()
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+	svc.cache.snapshot.Store(newCacheSnapshot(stored, time.Now().Add(-time.Hour)))
+
+	for range 2 {
+		currencies, err := svc.GetCurrencies(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, stored, currencies)
+	}
+
+	// Once the reload has failed, the expired snapshot is still cached.
+	assert.Eventually(t, func() bool { return !svc.cache.refreshing.Load() }, 5*time.Second, time.Millisecond)
+	repo.AssertCalled(t, "SelectAllCurrencies", mock.Anything)
+	assert.Equal(t, stored, svc.cache.snapshot.Load().currencies)
+}
+
+func TestReadCacheDisabled(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency(nil), nil)
+
+	conf := config.Default()
+	conf.CacheTTL = 0
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	for range 2 {
+		_, err := svc.GetCurrencies(context.Background())
+		require.NoError(t, err)
+	}
+
+	repo.AssertNumberOfCalls(t, "SelectAllCurrencies", 2)
+}
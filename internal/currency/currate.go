@@ -0,0 +1,93 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+)
+
+var errProviderStatus = errors.New("provider returned an error")
+
+// CurrateProvider fetches rates from https://currate.ru.
+type CurrateProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewCurrateProvider(baseURL, apiKey string, timeout time.Duration) *CurrateProvider {
+	dialTimeout := 5
+
+	transport := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: time.Duration(dialTimeout) * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: time.Duration(dialTimeout) * time.Second,
+	}
+
+	return &CurrateProvider{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+	}
+}
+
+func (p *CurrateProvider) Name() string {
+	return config.ProviderCurrate
+}
+
+func (p *CurrateProvider) FetchRates(ctx context.Context, pairs []string) ([]Quote, error) {
+	var data DataCurrencyMonitor
+
+	query := url.Values{"get": {"rates"}, "pairs": {strings.Join(pairs, ",")}, "key": {p.apiKey}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in CurrateProvider's method FetchRates: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error in CurrateProvider's method FetchRates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error in CurrateProvider's method FetchRates: %w", err)
+	}
+
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, fmt.Errorf("error in CurrateProvider's method FetchRates: %w", err)
+	}
+
+	if data.Status != http.StatusOK {
+		return nil, fmt.Errorf("error in CurrateProvider's method FetchRates: %w: %d %s",
+			errProviderStatus, data.Status, data.Message)
+	}
+
+	quotes := make([]Quote, 0, len(data.Data))
+
+	for _, pair := range pairs {
+		if price, ok := data.Data[pair]; ok {
+			quotes = append(quotes, Quote{Pair: pair, Price: price})
+		}
+	}
+
+	return quotes, nil
+}
@@ -0,0 +1,68 @@
+package currency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrateFetchRates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		response   string
+		wantQuotes []Quote
+		wantErr    error
+	}{
+		{
+			name:     "ok",
+			response: `{"status":200,"message":"rates","data":{"ETHRUB":"250000.5","BTCRUB":"6000000"}}`,
+			wantQuotes: []Quote{
+				{Pair: "BTCRUB", Price: "6000000"},
+				{Pair: "ETHRUB", Price: "250000.5"},
+			},
+		},
+		{
+			name:       "missing pair",
+			response:   `{"status":200,"message":"rates","data":{"BTCRUB":"6000000"}}`,
+			wantQuotes: []Quote{{Pair: "BTCRUB", Price: "6000000"}},
+		},
+		{
+			name:     "provider error",
+			response: `{"status":403,"message":"invalid key"}`,
+			wantErr:  errProviderStatus,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				assert.Equal(t, "BTCRUB,ETHRUB", request.URL.Query().Get("pairs"))
+				assert.Equal(t, "k&y", request.URL.Query().Get("key"))
+
+				_, _ = writer.Write([]byte(testCase.response))
+			}))
+			defer server.Close()
+
+			provider := NewCurrateProvider(server.URL+"/api/", "k&y", time.Second)
+
+			quotes, err := provider.FetchRates(context.Background(), []string{"BTCRUB", "ETHRUB"})
+			if testCase.wantErr != nil {
+				require.ErrorIs(t, err, testCase.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, testCase.wantQuotes, quotes)
+		})
+	}
+}
@@ -2,30 +2,58 @@ package currency
 
 import (
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
+// Currency holds exact decimal prices, which JSON encodes as strings such as "3850000.25".
+// CurrencyQuotedAt is when the provider quoted the price and CurrencyLastUpdate is when it
+// was stored; for providers that do not report quote times both are the time of storing.
 type Currency struct {
-	CurrencyID            int64     `json:"currencyId"`
-	CurrencyName          string    `json:"currencyName"`
-	CurrencyPrice         float64   `json:"currencyPrice"`
-	CurrencyMinPrice      float64   `json:"currencyMinPrice"`
-	CurrencyMaxPrice      float64   `json:"currencyMaxPrice"`
-	CurrencyChangePerHour float64   `json:"currencyChangePerHour"`
-	CurrencyLastUpdate    time.Time `json:"currencyLastUpdate"`
+	CurrencyID            int64           `json:"currencyId"            xml:"currencyId"`
+	CurrencyName          string          `json:"currencyName"          xml:"currencyName"`
+	CurrencyPrice         decimal.Decimal `json:"currencyPrice"         xml:"currencyPrice"`
+	CurrencyMinPrice      decimal.Decimal `json:"currencyMinPrice"      xml:"currencyMinPrice"`
+	CurrencyMaxPrice      decimal.Decimal `json:"currencyMaxPrice"      xml:"currencyMaxPrice"`
+	CurrencyChangePerHour decimal.Decimal `json:"currencyChangePerHour" xml:"currencyChangePerHour"`
+	CurrencyLastUpdate    time.Time       `json:"currencyLastUpdate"    xml:"currencyLastUpdate"`
+	CurrencyQuotedAt      time.Time       `json:"currencyQuotedAt"      xml:"currencyQuotedAt"`
+	// CurrencyExtremes is only filled in for a single currency, see Service.GetCurrency.
+	CurrencyExtremes []WindowExtremes `json:"currencyExtremes,omitempty" xml:"currencyExtremes>window,omitempty"`
 }
 
-type DataCurrencyMonitor struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
-	Data    Data   `json:"data"`
+// ExtremeWindow is a window of history ending now, such as the last 24 hours.
+type ExtremeWindow struct {
+	Name  string
+	Since time.Time
+}
+
+// Extreme is a price and when it was quoted.
+type Extreme struct {
+	Price decimal.Decimal `json:"price" xml:"price"`
+	At    time.Time       `json:"at"    xml:"at"`
 }
 
-type Data struct {
-	BTCRUB string `json:"BTCRUB"`
-	ETHRUB string `json:"ETHRUB"`
+// WindowExtremes are the lowest and highest prices in a window of history. If
+// a price was reached several times, At is the latest.
+type WindowExtremes struct {
+	Window string  `json:"window" xml:"name,attr"`
+	Min    Extreme `json:"min"    xml:"min"`
+	Max    Extreme `json:"max"    xml:"max"`
 }
 
-type LastUpdate struct {
-	BTC time.Time
-	ETH time.Time
+// HistoryRecord is a past price. CreatedAt is the time the price applies to, which is
+// the quote time when the provider reports one, and IngestedAt is when it was stored.
+type HistoryRecord struct {
+	CurrencyName  string          `json:"currencyName"  xml:"currencyName"`
+	CurrencyPrice decimal.Decimal `json:"currencyPrice" xml:"currencyPrice"`
+	CreatedAt     time.Time       `json:"createdAt"     xml:"createdAt"`
+	IngestedAt    time.Time       `json:"ingestedAt"    xml:"ingestedAt"`
+}
+
+// DataCurrencyMonitor is the currate.ru response; Data maps pairs such as BTCRUB to prices.
+type DataCurrencyMonitor struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data"`
 }
@@ -3,18 +3,27 @@ package currency
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/crackc0der/currency/config"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
 )
 
+var errInvalidTimeRange = errors.New("from must not be after to")
+
 type EndpointInterface interface {
 	GetCurrencies(context.Context) ([]Currency, error)
 	GetCurrency(context.Context, string) (*Currency, error)
 	SetCurrencies(context.Context, []Currency) ([]Currency, error)
-	GetChangesPerHour(context.Context, string) (float64, error)
+	GetChangesPerHour(context.Context, string) (decimal.Decimal, error)
 }
 
 type Endpoint struct {
@@ -27,28 +36,186 @@ func NewEndpoint(service *Service, log *slog.Logger, config *config.Config) *End
 	return &Endpoint{service: service, log: log, config: config}
 }
 
+// GetCurrencies writes all currencies as JSON, CSV, XML or Prometheus text,
+// chosen by the format query parameter or the Accept header.
 func (e Endpoint) GetCurrencies(writer http.ResponseWriter, request *http.Request) {
+	format, err := negotiateFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
 	currencies, err := e.service.GetCurrencies(request.Context())
 	if err != nil {
-		e.log.Error("error in Endpoint's method GetCurrencies: " + err.Error())
+		e.log.Error("error in Endpoint's method GetCurrencies", slog.Any("error", err))
+		http.Error(writer, "could not get currencies", http.StatusInternalServerError)
+
+		return
 	}
 
-	if err = json.NewEncoder(writer).Encode(&currencies); err != nil {
-		e.log.Error("error in Endpoint's method GetCurrencies: " + err.Error())
+	if err = writeCurrencies(writer, format, currencies, false); err != nil {
+		e.log.Error("error in Endpoint's method GetCurrencies", slog.Any("error", err))
 	}
 }
 
 func (e Endpoint) GetCurrency(writer http.ResponseWriter, request *http.Request) {
 	currencyName := mux.Vars(request)["name"]
 
+	format, err := negotiateFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
 	currency, err := e.service.GetCurrency(request.Context(), currencyName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(writer, "currency not found", http.StatusNotFound)
+
+		return
+	}
+
+	if err != nil {
+		e.log.Error("error in Endpoint's method GetCurrency", slog.Any("error", err))
+		http.Error(writer, "could not get currency", http.StatusInternalServerError)
+
+		return
+	}
+
+	if err = writeCurrencies(writer, format, []Currency{*currency}, true); err != nil {
+		e.log.Error("error in Endpoint's method GetCurrency", slog.Any("error", err))
+	}
+}
+
+// GetHistory writes the stored prices of a currency in the negotiated format. The optional
+// from and to query parameters are RFC 3339 timestamps and default to the last 24 hours.
+func (e Endpoint) GetHistory(writer http.ResponseWriter, request *http.Request) {
+	currencyName := mux.Vars(request)["name"]
+
+	format, err := negotiateFormat(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	from, to, err := parseTimeRange(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	history, err := e.service.GetHistory(request.Context(), currencyName, from, to)
 	if err != nil {
-		e.log.Error("error in Endpoint's method GetCurrency: " + err.Error())
+		e.log.Error("error in Endpoint's method GetHistory", slog.Any("error", err))
+		http.Error(writer, "could not get history", http.StatusInternalServerError)
+
+		return
+	}
+
+	if err = writeHistory(writer, format, history); err != nil {
+		e.log.Error("error in Endpoint's method GetHistory", slog.Any("error", err))
+	}
+}
+
+// GetIndicators writes a technical indicator of a currency as JSON. The type query parameter is
+// one of sma, ema, rsi, macd and bollinger; period, interval (such as 15m), k (Bollinger band
+// width in standard deviations), from and to are optional.
+func (e Endpoint) GetIndicators(writer http.ResponseWriter, request *http.Request) {
+	query, err := parseIndicatorQuery(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	indicator, err := e.service.GetIndicator(request.Context(), mux.Vars(request)["name"], query)
+
+	switch {
+	case errors.Is(err, errIndicatorType), errors.Is(err, errIndicatorPeriod), errors.Is(err, errIndicatorInterval),
+		errors.Is(err, errIndicatorK), errors.Is(err, errIndicatorRange), errors.Is(err, errInvalidTimeRange):
+		http.Error(writer, errors.Unwrap(err).Error(), http.StatusBadRequest)
+
+		return
+	case err != nil:
+		e.log.Error("error in Endpoint's method GetIndicators", slog.Any("error", err))
+		http.Error(writer, "could not compute indicator", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(indicator); err != nil {
+		e.log.Error("error in Endpoint's method GetIndicators", slog.Any("error", err))
+	}
+}
+
+// GetStats writes the statistics of a currency's prices as JSON. The optional from
+// and to query parameters are RFC 3339 timestamps and default to the last 7 days.
+func (e Endpoint) GetStats(writer http.ResponseWriter, request *http.Request) {
+	from, to, err := parseTimeRange(request)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	stats, err := e.service.GetStats(request.Context(), mux.Vars(request)["name"], from, to)
+	if errors.Is(err, errInvalidTimeRange) {
+		http.Error(writer, errInvalidTimeRange.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err != nil {
+		e.log.Error("error in Endpoint's method GetStats", slog.Any("error", err))
+		http.Error(writer, "could not compute stats", http.StatusInternalServerError)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", formatContentTypes[formatJSON])
+
+	if err = json.NewEncoder(writer).Encode(stats); err != nil {
+		e.log.Error("error in Endpoint's method GetStats", slog.Any("error", err))
+	}
+}
+
+func parseIndicatorQuery(request *http.Request) (IndicatorQuery, error) {
+	from, to, err := parseTimeRange(request)
+	if err != nil {
+		return IndicatorQuery{}, err
+	}
+
+	values := request.URL.Query()
+	query := IndicatorQuery{Type: strings.ToLower(values.Get("type")), From: from, To: to}
+
+	if query.Type == "" {
+		query.Type = IndicatorSMA
+	}
+
+	if value := values.Get("period"); value != "" {
+		if query.Period, err = strconv.Atoi(value); err != nil {
+			return query, fmt.Errorf("invalid period parameter: %w", err)
+		}
+	}
+
+	if value := values.Get("interval"); value != "" {
+		if query.Interval, err = time.ParseDuration(value); err != nil {
+			return query, fmt.Errorf("invalid interval parameter: %w", err)
+		}
 	}
 
-	if err = json.NewEncoder(writer).Encode(&currency); err != nil {
-		e.log.Error("error in Endpoint's method GetCurrency: " + err.Error())
+	if value := values.Get("k"); value != "" {
+		if query.K, err = strconv.ParseFloat(value, 64); err != nil {
+			return query, fmt.Errorf("invalid k parameter: %w", err)
+		}
 	}
+
+	return query, nil
 }
 
 func (e Endpoint) GetChangesPerHour(writer http.ResponseWriter, request *http.Request) {
@@ -56,10 +223,185 @@ func (e Endpoint) GetChangesPerHour(writer http.ResponseWriter, request *http.Re
 
 	currencyChange, err := e.service.GetChangesPerHour(request.Context(), currencyName)
 	if err != nil {
-		e.log.Error("error in Endpoint's method GetChangesPerHour: " + err.Error())
+		e.log.Error("error in Endpoint's method GetChangesPerHour", slog.Any("error", err))
 	}
 
 	if err = json.NewEncoder(writer).Encode(&currencyChange); err != nil {
-		e.log.Error("error in Endpoint's method GetChangesPerHour: " + err.Error())
+		e.log.Error("error in Endpoint's method GetChangesPerHour", slog.Any("error", err))
+	}
+}
+
+// StreamCurrencies pushes every stored rate update to the client as Server-Sent Events.
+// The optional names query parameter (names=BTC,ETH) limits the currencies sent, and
+// a Last-Event-ID header replays the updates the client missed while disconnected.
+func (e Endpoint) StreamCurrencies(writer http.ResponseWriter, request *http.Request) {
+	heartbeat := 15 * time.Second
+
+	controller := http.NewResponseController(writer)
+
+	// The server's WriteTimeout would otherwise cut the stream after a few seconds.
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		e.log.Error("error in Endpoint's method StreamCurrencies", slog.Any("error", err))
+		http.Error(writer, "streaming unsupported", http.StatusInternalServerError)
+
+		return
+	}
+
+	names := parseNamesFilter(request.URL.Query().Get("names"))
+
+	lastEventID, resume := parseLastEventID(request)
+
+	updates, missed, unsubscribe := e.service.Updates().Subscribe(lastEventID)
+	defer unsubscribe()
+
+	// A fresh client only needs the latest known prices, not the whole backlog.
+	if !resume && len(missed) > 0 {
+		missed = missed[len(missed)-1:]
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.WriteHeader(http.StatusOK)
+
+	for _, update := range missed {
+		if err := e.writeEvent(writer, update, names); err != nil {
+			e.log.Error("error in Endpoint's method StreamCurrencies", slog.Any("error", err))
+
+			return
+		}
+	}
+
+	if err := controller.Flush(); err != nil {
+		e.log.Error("error in Endpoint's method StreamCurrencies", slog.Any("error", err))
+
+		return
+	}
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+
+		case update, ok := <-updates:
+			if !ok {
+				// Dropped as a slow subscriber or shutting down; the client reconnects with Last-Event-ID.
+				return
+			}
+
+			if err := e.writeEvent(writer, update, names); err != nil {
+				e.log.Error("error in Endpoint's method StreamCurrencies", slog.Any("error", err))
+
+				return
+			}
+		}
+
+		if err := controller.Flush(); err != nil {
+			return
+		}
 	}
 }
+
+func (e Endpoint) writeEvent(writer http.ResponseWriter, update RatesUpdate, names map[string]struct{}) error {
+	currencies := filterCurrencies(update.Currencies, names)
+	if len(currencies) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(currencies)
+	if err != nil {
+		return fmt.Errorf("error in Endpoint's method writeEvent: %w", err)
+	}
+
+	_, err = fmt.Fprintf(writer, "id: %d\nevent: rates\ndata: %s\n\n", update.ID, data)
+	if err != nil {
+		return fmt.Errorf("error in Endpoint's method writeEvent: %w", err)
+	}
+
+	return nil
+}
+
+func parseTimeRange(request *http.Request) (time.Time, time.Time, error) {
+	var from, to time.Time
+
+	query := request.URL.Query()
+
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from parameter: %w", err)
+		}
+
+		from = parsed
+	}
+
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to parameter: %w", err)
+		}
+
+		to = parsed
+	}
+
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return from, to, errInvalidTimeRange
+	}
+
+	return from, to, nil
+}
+
+func parseLastEventID(request *http.Request) (uint64, bool) {
+	value := request.Header.Get("Last-Event-ID")
+	if value == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
+
+func parseNamesFilter(value string) map[string]struct{} {
+	if value == "" {
+		return nil
+	}
+
+	names := make(map[string]struct{})
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name != "" {
+			names[name] = struct{}{}
+		}
+	}
+
+	return names
+}
+
+func filterCurrencies(currencies []Currency, names map[string]struct{}) []Currency {
+	if names == nil {
+		return currencies
+	}
+
+	filtered := make([]Currency, 0, len(names))
+
+	for _, currency := range currencies {
+		if _, ok := names[strings.ToUpper(currency.CurrencyName)]; ok {
+			filtered = append(filtered, currency)
+		}
+	}
+
+	return filtered
+}
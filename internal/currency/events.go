@@ -0,0 +1,148 @@
+package currency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	EventRateUpdated = "rate_updated"
+	EventFetchFailed = "fetch_failed"
+	EventNewExtreme  = "new_extreme"
+
+	ExtremeMin = "min"
+	ExtremeMax = "max"
+
+	// eventSubscriberBuffer is the number of events a subscriber may fall behind by.
+	eventSubscriberBuffer = 64
+)
+
+// Event is something that happened to the rates: a RateUpdated, FetchFailed or NewExtreme.
+type Event interface {
+	// EventName is the name of the event type, such as rate_updated.
+	EventName() string
+}
+
+// RateUpdated is published after prices are stored. Update is also what the
+// Broadcaster streams to SSE, WebSocket and gRPC clients.
+type RateUpdated struct {
+	Update RatesUpdate
+}
+
+func (RateUpdated) EventName() string { return EventRateUpdated }
+
+// FetchFailed is published when CurrencyMonitor could not fetch or store prices.
+type FetchFailed struct {
+	Provider string
+	Err      error
+	At       time.Time
+}
+
+func (FetchFailed) EventName() string { return EventFetchFailed }
+
+// NewExtreme is published when a stored price is below the all-time minimum or
+// above the all-time maximum of its currency. Kind is ExtremeMin or ExtremeMax.
+type NewExtreme struct {
+	CurrencyName string
+	Kind         string
+	Price        decimal.Decimal
+	Previous     decimal.Decimal
+	QuotedAt     time.Time
+}
+
+func (NewExtreme) EventName() string { return EventNewExtreme }
+
+// EventBus delivers events to the subscribers of their type. Unlike the
+// Broadcaster it keeps no backlog: a subscriber only sees events published
+// while it is subscribed, and an event is dropped for a subscriber whose buffer
+// is full, so a slow subscriber never blocks the publisher. Events stay in the
+// process that publishes them; the streams read the Broadcaster instead, which
+// WatchStored also feeds with the rates stored by other processes.
+type EventBus struct {
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[*eventSubscriber]struct{}
+}
+
+type eventSubscriber struct {
+	// deliver sends event without blocking and ignores events of other types.
+	deliver func(event Event)
+	close   func()
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Publish delivers event to every subscriber of its type.
+func (b *EventBus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	observeEvent(event.EventName())
+
+	for subscriber := range b.subscribers {
+		subscriber.deliver(event)
+	}
+}
+
+// Subscribe returns the events of type E published from now on; with E = Event
+// it returns all of them. The returned function unsubscribes and must be called
+// once the caller stops reading. After Close the channel is closed.
+func Subscribe[E Event](bus *EventBus) (<-chan E, func()) {
+	events := make(chan E, eventSubscriberBuffer)
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	if bus.closed {
+		close(events)
+
+		return events, func() {}
+	}
+
+	subscriber := &eventSubscriber{
+		deliver: func(event Event) {
+			typed, ok := event.(E)
+			if !ok {
+				return
+			}
+
+			select {
+			case events <- typed:
+			default:
+				observeDroppedEvent(event.EventName())
+			}
+		},
+		close: func() { close(events) },
+	}
+
+	bus.subscribers[subscriber] = struct{}{}
+
+	unsubscribe := func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+
+		if _, ok := bus.subscribers[subscriber]; ok {
+			delete(bus.subscribers, subscriber)
+			subscriber.close()
+		}
+	}
+
+	return events, unsubscribe
+}
+
+// Close ends every subscription and makes later ones return a closed channel.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for subscriber := range b.subscribers {
+		delete(b.subscribers, subscriber)
+		subscriber.close()
+	}
+}
@@ -0,0 +1,130 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errFetchTimeout = errors.New("timeout")
+
+func TestEventBusSubscribe(t *testing.T) {
+	t.Parallel()
+
+	bus := NewEventBus()
+
+	all, unsubscribeAll := Subscribe[Event](bus)
+	defer unsubscribeAll()
+
+	failures, unsubscribeFailures := Subscribe[FetchFailed](bus)
+
+	bus.Publish(RateUpdated{Update: RatesUpdate{ID: 1}})
+	bus.Publish(FetchFailed{Provider: "currate"})
+
+	assert.Equal(t, EventRateUpdated, (<-all).EventName())
+	assert.Equal(t, EventFetchFailed, (<-all).EventName())
+	assert.Equal(t, "currate", (<-failures).Provider)
+	assert.Empty(t, failures, "events of other types are not delivered")
+
+	unsubscribeFailures()
+	unsubscribeFailures()
+
+	_, ok := <-failures
+	assert.False(t, ok)
+
+	bus.Close()
+
+	_, ok = <-all
+	assert.False(t, ok)
+
+	late, _ := Subscribe[Event](bus)
+	_, ok = <-late
+	assert.False(t, ok, "subscribing after Close returns a closed channel")
+}
+
+func TestEventBusDropsForSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	bus := NewEventBus()
+
+	events, unsubscribe := Subscribe[RateUpdated](bus)
+	defer unsubscribe()
+
+	for i := range eventSubscriberBuffer + 1 {
+		bus.Publish(RateUpdated{Update: RatesUpdate{ID: uint64(i + 1)}})
+	}
+
+	require.Len(t, events, eventSubscriberBuffer)
+	assert.Equal(t, uint64(1), (<-events).Update.ID, "the newest event is dropped, not the oldest")
+}
+
+func TestFetchPublishesEvents(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName:     "BTC",
+		CurrencyMinPrice: decimal.NewFromInt(90),
+		CurrencyMaxPrice: decimal.NewFromInt(100),
+	}, nil)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	events, unsubscribe := Subscribe[Event](svc.Events())
+	defer unsubscribe()
+
+	_, err := svc.storeCurrencies(context.Background(), map[string]Quote{"BTC": {Price: "120"}})
+	require.NoError(t, err)
+
+	updated, ok := (<-events).(RateUpdated)
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), updated.Update.ID)
+
+	extreme, ok := (<-events).(NewExtreme)
+	require.True(t, ok)
+	assert.Equal(t, ExtremeMax, extreme.Kind)
+	assert.True(t, decimal.NewFromInt(100).Equal(extreme.Previous))
+
+	_, err = svc.Fetch(context.Background())
+	require.ErrorIs(t, err, errNoProvider)
+
+	failed, ok := (<-events).(FetchFailed)
+	require.True(t, ok)
+	assert.ErrorIs(t, failed.Err, errNoProvider)
+
+	// Webhooks are queued with the rates, not from the bus, which can drop events.
+	for _, event := range []string{EventRateUpdated, EventNewExtreme, EventFetchFailed} {
+		repo.AssertCalled(t, "InsertWebhookDeliveries", mock.Anything, event, mock.Anything)
+	}
+}
+
+func TestFetchStatusMessage(t *testing.T) {
+	t.Parallel()
+
+	failing := false
+	failed := FetchFailed{Provider: "currate", Err: errFetchTimeout}
+
+	message, changed := fetchStatusMessage(failed, &failing)
+	assert.True(t, changed)
+	assert.Contains(t, message, "currate")
+	assert.NotContains(t, message, "timeout", "errors may hold secrets and stay in the log")
+
+	_, changed = fetchStatusMessage(failed, &failing)
+	assert.False(t, changed, "only the first failure is reported")
+
+	message, changed = fetchStatusMessage(RateUpdated{}, &failing)
+	assert.True(t, changed)
+	assert.Equal(t, "Fetching rates recovered.", message)
+
+	_, changed = fetchStatusMessage(RateUpdated{}, &failing)
+	assert.False(t, changed)
+}
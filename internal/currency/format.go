@@ -0,0 +1,335 @@
+package currency
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatXML  = "xml"
+	formatText = "text"
+)
+
+var errUnknownFormat = errors.New("unknown format, expected one of json, csv, xml, text")
+
+//nolint:gochecknoglobals
+var formatContentTypes = map[string]string{
+	formatJSON: "application/json",
+	formatCSV:  "text/csv; charset=utf-8",
+	formatXML:  "application/xml; charset=utf-8",
+	formatText: "text/plain; version=0.0.4; charset=utf-8",
+}
+
+type xmlCurrencies struct {
+	XMLName    xml.Name   `xml:"currencies"`
+	Currencies []Currency `xml:"currency"`
+}
+
+type xmlHistory struct {
+	XMLName xml.Name        `xml:"history"`
+	Records []HistoryRecord `xml:"record"`
+}
+
+// acceptFormats maps the Accept media types the service can produce to formats.
+// Wildcards stand for JSON.
+//
+//nolint:gochecknoglobals
+var acceptFormats = map[string]string{
+	"application/json": formatJSON,
+	"text/csv":         formatCSV,
+	"application/xml":  formatXML,
+	"text/xml":         formatXML,
+	"text/plain":       formatText,
+	"*/*":              formatJSON,
+	"application/*":    formatJSON,
+}
+
+// formatQualities weigh the client's q-values with the service's own preference
+// for JSON, so that a browser, which accepts XML a little more than anything,
+// still gets JSON.
+//
+//nolint:gochecknoglobals
+var formatQualities = map[string]float64{formatJSON: 1, formatCSV: 0.8, formatXML: 0.8, formatText: 0.8}
+
+type acceptedFormat struct {
+	format   string
+	quality  float64
+	wildcard bool
+}
+
+// negotiateFormat picks the response format from the format query parameter or,
+// if it is absent, the Accept media type with the highest q-value, weighed by
+// formatQualities; ties go to the first. Types with q=0 are refused, and a type
+// named explicitly overrides a wildcard. JSON is the default.
+func negotiateFormat(request *http.Request) (string, error) {
+	if format := request.URL.Query().Get("format"); format != "" {
+		return ParseFormat(format)
+	}
+
+	accepted := parseAccept(request.Header.Get("Accept"))
+
+	best, bestQuality := formatJSON, 0.0
+
+	for _, candidate := range accepted {
+		if candidate.wildcard && slices.ContainsFunc(accepted, func(other acceptedFormat) bool {
+			return !other.wildcard && other.format == candidate.format
+		}) {
+			continue
+		}
+
+		if quality := candidate.quality * formatQualities[candidate.format]; quality > bestQuality {
+			best, bestQuality = candidate.format, quality
+		}
+	}
+
+	return best, nil
+}
+
+// parseAccept returns the formats of an Accept header in its order, skipping
+// media types the service cannot produce and invalid q-values.
+func parseAccept(header string) []acceptedFormat {
+	var accepted []acceptedFormat
+
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		format, ok := acceptFormats[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+
+		accepted = append(accepted, acceptedFormat{
+			format:   format,
+			quality:  quality,
+			wildcard: strings.HasSuffix(mediaType, "/*"),
+		})
+	}
+
+	return accepted
+}
+
+// ParseFormat validates a format name given outside of HTTP, such as on the command line.
+func ParseFormat(format string) (string, error) {
+	format = strings.ToLower(format)
+	if _, ok := formatContentTypes[format]; !ok {
+		return "", errUnknownFormat
+	}
+
+	return format, nil
+}
+
+// writeCurrencies sets the Content-Type for format and encodes currencies.
+func writeCurrencies(writer http.ResponseWriter, format string, currencies []Currency, single bool) error {
+	writer.Header().Set("Content-Type", formatContentTypes[format])
+
+	return encodeCurrencies(writer, format, currencies, single)
+}
+
+// EncodeCurrencies writes currencies in format, as GET /rates does.
+func EncodeCurrencies(writer io.Writer, format string, currencies []Currency) error {
+	return encodeCurrencies(writer, format, currencies, false)
+}
+
+// encodeCurrencies encodes currencies in format. single keeps the JSON and XML
+// shape of /rates/{name}, which returns one object rather than a list.
+func encodeCurrencies(writer io.Writer, format string, currencies []Currency, single bool) error {
+	var err error
+
+	switch format {
+	case formatCSV:
+		err = writeCurrenciesCSV(writer, currencies)
+	case formatXML:
+		if single && len(currencies) == 1 {
+			start := xml.StartElement{Name: xml.Name{Local: "currency"}}
+			err = xml.NewEncoder(writer).EncodeElement(&currencies[0], start)
+		} else {
+			err = xml.NewEncoder(writer).Encode(xmlCurrencies{Currencies: currencies})
+		}
+	case formatText:
+		err = writeCurrenciesText(writer, currencies)
+	default:
+		if single && len(currencies) == 1 {
+			err = json.NewEncoder(writer).Encode(&currencies[0])
+		} else {
+			err = json.NewEncoder(writer).Encode(&currencies)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("error in encodeCurrencies: %w", err)
+	}
+
+	return nil
+}
+
+func writeHistory(writer http.ResponseWriter, format string, history []HistoryRecord) error {
+	writer.Header().Set("Content-Type", formatContentTypes[format])
+
+	return EncodeHistory(writer, format, history)
+}
+
+// EncodeHistory writes history in format, as GET /rates/{name}/history does.
+func EncodeHistory(writer io.Writer, format string, history []HistoryRecord) error {
+	var err error
+
+	switch format {
+	case formatCSV:
+		err = writeHistoryCSV(writer, history)
+	case formatXML:
+		err = xml.NewEncoder(writer).Encode(xmlHistory{Records: history})
+	case formatText:
+		err = writeHistoryText(writer, history)
+	default:
+		err = json.NewEncoder(writer).Encode(&history)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error in EncodeHistory: %w", err)
+	}
+
+	return nil
+}
+
+func writeCurrenciesCSV(writer io.Writer, currencies []Currency) error {
+	csvWriter := csv.NewWriter(writer)
+
+	err := csvWriter.Write([]string{
+		"currency_id", "currency_name", "price", "min_price", "max_price", "change_per_hour", "last_update",
+		"quoted_at",
+	})
+	if err != nil {
+		return fmt.Errorf("error in writeCurrenciesCSV: %w", err)
+	}
+
+	for _, currency := range currencies {
+		err := csvWriter.Write([]string{
+			strconv.FormatInt(currency.CurrencyID, 10),
+			currency.CurrencyName,
+			formatPrice(currency.CurrencyPrice),
+			formatPrice(currency.CurrencyMinPrice),
+			formatPrice(currency.CurrencyMaxPrice),
+			formatPrice(currency.CurrencyChangePerHour),
+			formatTime(currency.CurrencyLastUpdate),
+			formatTime(currency.CurrencyQuotedAt),
+		})
+		if err != nil {
+			return fmt.Errorf("error in writeCurrenciesCSV: %w", err)
+		}
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("error in writeCurrenciesCSV: %w", err)
+	}
+
+	return nil
+}
+
+func writeHistoryCSV(writer io.Writer, history []HistoryRecord) error {
+	csvWriter := csv.NewWriter(writer)
+
+	if err := csvWriter.Write([]string{"created_at", "currency_name", "price", "ingested_at"}); err != nil {
+		return fmt.Errorf("error in writeHistoryCSV: %w", err)
+	}
+
+	for _, record := range history {
+		err := csvWriter.Write([]string{
+			formatTime(record.CreatedAt),
+			record.CurrencyName,
+			formatPrice(record.CurrencyPrice),
+			formatTime(record.IngestedAt),
+		})
+		if err != nil {
+			return fmt.Errorf("error in writeHistoryCSV: %w", err)
+		}
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("error in writeHistoryCSV: %w", err)
+	}
+
+	return nil
+}
+
+// writeCurrenciesText writes one line per value in the Prometheus text exposition format.
+func writeCurrenciesText(writer io.Writer, currencies []Currency) error {
+	metrics := []struct {
+		name  string
+		value func(Currency) decimal.Decimal
+	}{
+		{"currency_price", func(c Currency) decimal.Decimal { return c.CurrencyPrice }},
+		{"currency_min_price", func(c Currency) decimal.Decimal { return c.CurrencyMinPrice }},
+		{"currency_max_price", func(c Currency) decimal.Decimal { return c.CurrencyMaxPrice }},
+		{"currency_change_per_hour", func(c Currency) decimal.Decimal { return c.CurrencyChangePerHour }},
+	}
+
+	for _, metric := range metrics {
+		if _, err := fmt.Fprintf(writer, "# TYPE %s gauge\n", metric.name); err != nil {
+			return fmt.Errorf("error in writeCurrenciesText: %w", err)
+		}
+
+		for _, currency := range currencies {
+			_, err := fmt.Fprintf(writer, "%s{currency=%q} %s %d\n", metric.name, currency.CurrencyName,
+				formatPrice(metric.value(currency)), currency.CurrencyLastUpdate.UnixMilli())
+			if err != nil {
+				return fmt.Errorf("error in writeCurrenciesText: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeHistoryText(writer io.Writer, history []HistoryRecord) error {
+	if _, err := fmt.Fprint(writer, "# TYPE currency_price gauge\n"); err != nil {
+		return fmt.Errorf("error in writeHistoryText: %w", err)
+	}
+
+	for _, record := range history {
+		_, err := fmt.Fprintf(writer, "currency_price{currency=%q} %s %d\n", record.CurrencyName,
+			formatPrice(record.CurrencyPrice), record.CreatedAt.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("error in writeHistoryText: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func formatPrice(price decimal.Decimal) string {
+	return price.String()
+}
+
+// formatTime formats t as RFC 3339 in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
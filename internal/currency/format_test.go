@@ -0,0 +1,189 @@
+package currency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		target  string
+		accept  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "default",
+			target: "/rates",
+			want:   formatJSON,
+		},
+		{
+			name:   "query parameter wins over accept",
+			target: "/rates?format=CSV",
+			accept: "application/xml",
+			want:   formatCSV,
+		},
+		{
+			name:   "highest quality accept type",
+			target: "/rates",
+			accept: "image/png, text/xml;q=0.9, text/plain",
+			want:   formatText,
+		},
+		{
+			name:   "lower quality accept type first",
+			target: "/rates",
+			accept: "text/csv;q=0.5, application/xml",
+			want:   formatXML,
+		},
+		{
+			name:   "ties go to the first accept type",
+			target: "/rates",
+			accept: "text/csv, text/plain",
+			want:   formatCSV,
+		},
+		{
+			name:   "browser",
+			target: "/rates",
+			accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			want:   formatJSON,
+		},
+		{
+			name:   "explicit xml",
+			target: "/rates",
+			accept: "application/xml",
+			want:   formatXML,
+		},
+		{
+			name:   "refused accept type",
+			target: "/rates",
+			accept: "application/json;q=0, text/csv;q=0.1",
+			want:   formatCSV,
+		},
+		{
+			name:   "explicit refusal overrides wildcard",
+			target: "/rates",
+			accept: "application/json;q=0, text/plain;q=0.1, */*",
+			want:   formatText,
+		},
+		{
+			name:   "only refused accept types",
+			target: "/rates",
+			accept: "text/csv;q=0",
+			want:   formatJSON,
+		},
+		{
+			name:   "wildcard accept",
+			target: "/rates",
+			accept: "*/*",
+			want:   formatJSON,
+		},
+		{
+			name:    "unknown query parameter",
+			target:  "/rates?format=yaml",
+			wantErr: errUnknownFormat,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodGet, testCase.target, nil)
+			request.Header.Set("Accept", testCase.accept)
+
+			got, err := negotiateFormat(request)
+			require.ErrorIs(t, err, testCase.wantErr)
+			assert.Equal(t, testCase.want, got)
+		})
+	}
+}
+
+func TestWriteHistoryCSV(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+
+	err := writeHistory(recorder, formatCSV, []HistoryRecord{
+		{
+			CurrencyName:  "BTC",
+			CurrencyPrice: decimal.RequireFromString("6543210.5"),
+			CreatedAt:     time.Date(2024, 1, 31, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60)),
+			IngestedAt:    time.Date(2024, 1, 31, 9, 0, 5, 0, time.UTC),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "created_at,currency_name,price,ingested_at\n"+
+		"2024-01-31T09:00:00Z,BTC,6543210.5,2024-01-31T09:00:05Z\n", recorder.Body.String())
+}
+
+func TestFormatRates(t *testing.T) {
+	t.Parallel()
+
+	location, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	message := formatRates([]Currency{
+		{
+			CurrencyName:     "BTC",
+			CurrencyPrice:    decimal.RequireFromString("3850000.25"),
+			CurrencyQuotedAt: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			CurrencyName:     "ETH",
+			CurrencyPrice:    decimal.RequireFromString("210000"),
+			CurrencyQuotedAt: time.Date(2024, 1, 31, 21, 30, 0, 0, time.UTC),
+		},
+	}, location)
+
+	assert.Equal(t, "BTC = 3850000.25 at 2024-01-31 12:00 MSK\nETH = 210000 at 2024-02-01 00:30 MSK", message)
+}
+
+func TestFormatRateWithExtremes(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+
+	message := formatRate(Currency{
+		CurrencyName:     "BTC",
+		CurrencyPrice:    decimal.RequireFromString("3850000"),
+		CurrencyQuotedAt: at,
+		CurrencyExtremes: []WindowExtremes{{
+			Window: "24h",
+			Min:    Extreme{Price: decimal.RequireFromString("3800000"), At: at.Add(-time.Hour)},
+			Max:    Extreme{Price: decimal.RequireFromString("3900000.5"), At: at.Add(-2 * time.Hour)},
+		}},
+	}, time.UTC)
+
+	assert.Equal(t, "BTC = 3850000 at 2024-01-31 09:00 UTC\n"+
+		"24h: min 3800000 at 2024-01-31 08:00 UTC, max 3900000.5 at 2024-01-31 07:00 UTC", message)
+}
+
+func TestWriteCurrencyXMLWithExtremes(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+
+	err := writeCurrencies(recorder, formatXML, []Currency{{
+		CurrencyName: "BTC",
+		CurrencyExtremes: []WindowExtremes{{
+			Window: "7d",
+			Min:    Extreme{Price: decimal.RequireFromString("1.5")},
+			Max:    Extreme{Price: decimal.RequireFromString("2")},
+		}},
+	}}, true)
+	require.NoError(t, err)
+
+	assert.Contains(t, recorder.Body.String(),
+		`<currencyExtremes><window name="7d"><min><price>1.5</price>`)
+}
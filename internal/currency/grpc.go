@@ -0,0 +1,186 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/crackc0der/currency/internal/currency/currencypb"
+	"github.com/jackc/pgx/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCServer exposes Service over gRPC, see api/proto/currency/v1/currency.proto.
+type GRPCServer struct {
+	currencypb.UnimplementedCurrencyServiceServer
+	service *Service
+	log     *slog.Logger
+}
+
+func NewGRPCServer(service *Service, log *slog.Logger) *GRPCServer {
+	return &GRPCServer{service: service, log: log}
+}
+
+func (g *GRPCServer) GetCurrencies(
+	ctx context.Context, _ *currencypb.GetCurrenciesRequest,
+) (*currencypb.GetCurrenciesResponse, error) {
+	currencies, err := g.service.GetCurrencies(ctx)
+	if err != nil {
+		g.log.Error("error in GRPCServer's method GetCurrencies", slog.Any("error", err))
+
+		return nil, status.Error(codes.Internal, "could not get currencies")
+	}
+
+	return &currencypb.GetCurrenciesResponse{Currencies: toProtoCurrencies(currencies)}, nil
+}
+
+func (g *GRPCServer) GetCurrency(
+	ctx context.Context, request *currencypb.GetCurrencyRequest,
+) (*currencypb.Currency, error) {
+	currency, err := g.service.GetCurrency(ctx, request.GetName())
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, status.Errorf(codes.NotFound, "currency %q not found", request.GetName())
+	}
+
+	if err != nil {
+		g.log.Error("error in GRPCServer's method GetCurrency", slog.Any("error", err))
+
+		return nil, status.Error(codes.Internal, "could not get currency")
+	}
+
+	return toProtoCurrency(*currency), nil
+}
+
+func (g *GRPCServer) GetHistory(
+	ctx context.Context, request *currencypb.GetHistoryRequest,
+) (*currencypb.GetHistoryResponse, error) {
+	var from, to time.Time
+
+	if request.GetFrom() != nil {
+		from = request.GetFrom().AsTime()
+	}
+
+	if request.GetTo() != nil {
+		to = request.GetTo().AsTime()
+	}
+
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return nil, status.Error(codes.InvalidArgument, errInvalidTimeRange.Error())
+	}
+
+	history, err := g.service.GetHistory(ctx, request.GetName(), from, to)
+	if err != nil {
+		g.log.Error("error in GRPCServer's method GetHistory", slog.Any("error", err))
+
+		return nil, status.Error(codes.Internal, "could not get history")
+	}
+
+	records := make([]*currencypb.HistoryRecord, 0, len(history))
+
+	for _, record := range history {
+		records = append(records, &currencypb.HistoryRecord{
+			Name:         record.CurrencyName,
+			Price:        record.CurrencyPrice.InexactFloat64(),
+			PriceDecimal: record.CurrencyPrice.String(),
+			CreatedAt:    timestamppb.New(record.CreatedAt),
+			IngestedAt:   timestamppb.New(record.IngestedAt),
+		})
+	}
+
+	return &currencypb.GetHistoryResponse{Records: records}, nil
+}
+
+func (g *GRPCServer) WatchRates(
+	request *currencypb.WatchRatesRequest, stream currencypb.CurrencyService_WatchRatesServer,
+) error {
+	names := parseNamesFilter(strings.Join(request.GetNames(), ","))
+
+	updates, missed, unsubscribe := g.service.Updates().Subscribe(request.GetLastUpdateId())
+	defer unsubscribe()
+
+	if request.GetLastUpdateId() == 0 && len(missed) > 0 {
+		missed = missed[len(missed)-1:]
+	}
+
+	for _, update := range missed {
+		if err := g.sendUpdate(stream, update, names); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case update, ok := <-updates:
+			if !ok {
+				return status.Error(codes.Unavailable, "update stream closed, resume with last_update_id")
+			}
+
+			if err := g.sendUpdate(stream, update, names); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (g *GRPCServer) sendUpdate(
+	stream currencypb.CurrencyService_WatchRatesServer, update RatesUpdate, names map[string]struct{},
+) error {
+	currencies := filterCurrencies(update.Currencies, names)
+	if len(currencies) == 0 {
+		return nil
+	}
+
+	err := stream.Send(&currencypb.RatesUpdate{Id: update.ID, Currencies: toProtoCurrencies(currencies)})
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	return nil
+}
+
+func toProtoCurrencies(currencies []Currency) []*currencypb.Currency {
+	result := make([]*currencypb.Currency, 0, len(currencies))
+
+	for _, currency := range currencies {
+		result = append(result, toProtoCurrency(currency))
+	}
+
+	return result
+}
+
+func toProtoCurrency(currency Currency) *currencypb.Currency {
+	extremes := make([]*currencypb.WindowExtremes, 0, len(currency.CurrencyExtremes))
+
+	for _, window := range currency.CurrencyExtremes {
+		extremes = append(extremes, &currencypb.WindowExtremes{
+			Window:   window.Window,
+			MinPrice: window.Min.Price.String(),
+			MinAt:    timestamppb.New(window.Min.At),
+			MaxPrice: window.Max.Price.String(),
+			MaxAt:    timestamppb.New(window.Max.At),
+		})
+	}
+
+	return &currencypb.Currency{
+		Id:                   currency.CurrencyID,
+		Name:                 currency.CurrencyName,
+		Price:                currency.CurrencyPrice.InexactFloat64(),
+		MinPrice:             currency.CurrencyMinPrice.InexactFloat64(),
+		MaxPrice:             currency.CurrencyMaxPrice.InexactFloat64(),
+		ChangePerHour:        currency.CurrencyChangePerHour.InexactFloat64(),
+		LastUpdate:           timestamppb.New(currency.CurrencyLastUpdate),
+		PriceDecimal:         currency.CurrencyPrice.String(),
+		MinPriceDecimal:      currency.CurrencyMinPrice.String(),
+		MaxPriceDecimal:      currency.CurrencyMaxPrice.String(),
+		ChangePerHourDecimal: currency.CurrencyChangePerHour.String(),
+		QuotedAt:             timestamppb.New(currency.CurrencyQuotedAt),
+		Extremes:             extremes,
+	}
+}
@@ -0,0 +1,149 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/internal/currency/currencypb"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func dialGRPC(t *testing.T, repo *MockRepo) (*Service, currencypb.CurrencyServiceClient) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := NewService(repo, logger, nil)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	currencypb.RegisterCurrencyServiceServer(server, NewGRPCServer(svc, logger))
+
+	go func() { _ = server.Serve(listener) }()
+
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return svc, currencypb.NewCurrencyServiceClient(conn)
+}
+
+func TestGRPCUnary(t *testing.T) {
+	t.Parallel()
+
+	quoted := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	btc := Currency{CurrencyName: "BTC", CurrencyPrice: decimal.RequireFromString("100.25"), CurrencyQuotedAt: quoted}
+
+	repo := new(MockRepo)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency{btc}, nil)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&btc, nil)
+	repo.On("SelectCurrency", mock.Anything, "XRP").Return((*Currency)(nil), pgx.ErrNoRows)
+	repo.On("SelectExtremes", mock.Anything, "BTC", mock.Anything).Return([]WindowExtremes(nil), nil)
+	repo.On("SelectHistory", mock.Anything, "BTC", quoted.Add(-time.Hour), quoted, mock.Anything).Return([]HistoryRecord{
+		{CurrencyName: "BTC", CurrencyPrice: decimal.RequireFromString("99.5"), CreatedAt: quoted},
+	}, nil)
+
+	_, client := dialGRPC(t, repo)
+	ctx := context.Background()
+
+	currencies, err := client.GetCurrencies(ctx, &currencypb.GetCurrenciesRequest{})
+	require.NoError(t, err)
+	require.Len(t, currencies.GetCurrencies(), 1)
+	assert.Equal(t, "100.25", currencies.GetCurrencies()[0].GetPriceDecimal())
+
+	currency, err := client.GetCurrency(ctx, &currencypb.GetCurrencyRequest{Name: "BTC"})
+	require.NoError(t, err)
+	assert.Equal(t, "BTC", currency.GetName())
+	assert.Equal(t, quoted, currency.GetQuotedAt().AsTime())
+
+	_, err = client.GetCurrency(ctx, &currencypb.GetCurrencyRequest{Name: "XRP"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	history, err := client.GetHistory(ctx, &currencypb.GetHistoryRequest{
+		Name: "BTC", From: timestamppb.New(quoted.Add(-time.Hour)), To: timestamppb.New(quoted),
+	})
+	require.NoError(t, err)
+	require.Len(t, history.GetRecords(), 1)
+	assert.Equal(t, "99.5", history.GetRecords()[0].GetPriceDecimal())
+
+	_, err = client.GetHistory(ctx, &currencypb.GetHistoryRequest{
+		Name: "BTC", From: timestamppb.New(quoted), To: timestamppb.New(quoted.Add(-time.Hour)),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCWatchRates(t *testing.T) {
+	t.Parallel()
+
+	svc, client := dialGRPC(t, new(MockRepo))
+
+	svc.Updates().Publish([]Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(1)}})
+	svc.Updates().Publish([]Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(2)}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchRates(ctx, &currencypb.WatchRatesRequest{Names: []string{"btc"}})
+	require.NoError(t, err)
+
+	// A fresh subscriber first gets only the latest update.
+	update, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), update.GetId())
+
+	svc.Updates().Publish([]Currency{{CurrencyName: "ETH", CurrencyPrice: decimal.NewFromInt(3)}})
+	svc.Updates().Publish([]Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(4)}})
+
+	// Updates without the requested currencies are skipped.
+	update, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), update.GetId())
+	assert.Equal(t, "4", update.GetCurrencies()[0].GetPriceDecimal())
+
+	svc.Updates().Close()
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPCWatchRatesResumes(t *testing.T) {
+	t.Parallel()
+
+	svc, client := dialGRPC(t, new(MockRepo))
+
+	for price := range 3 {
+		svc.Updates().Publish([]Currency{{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(int64(price))}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchRates(ctx, &currencypb.WatchRatesRequest{LastUpdateId: 1})
+	require.NoError(t, err)
+
+	for _, want := range []uint64{2, 3} {
+		update, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, want, update.GetId())
+	}
+}
@@ -0,0 +1,165 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+	// fetchStalenessGrace covers the time a scheduled fetch itself takes.
+	fetchStalenessGrace = time.Minute
+
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+
+	roleLeader   = "leader"
+	roleFollower = "follower"
+)
+
+var (
+	errNoFetchYet = errors.New("no successful fetch since start")
+	errFetchStale = errors.New("last successful fetch is older than the update interval")
+)
+
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Role       string                     `json:"role,omitempty"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+// Health serves the liveness and readiness probes.
+type Health struct {
+	service     *Service
+	log         *slog.Logger
+	runsJobs    bool
+	jobsElector *Elector
+	bot         *Bot
+	botElector  *Elector
+}
+
+// NewHealth creates the probes. Stored rates older than the configured update
+// interval make the instance unready.
+func NewHealth(service *Service, log *slog.Logger) *Health {
+	return &Health{service: service, log: log}
+}
+
+// WatchJobs makes readiness check this process's own fetches while elector
+// (nil if election is disabled) holds leadership.
+func (h *Health) WatchJobs(elector *Elector) {
+	h.runsJobs = true
+	h.jobsElector = elector
+}
+
+// WatchBot makes readiness check the bot poller while elector (nil if
+// election is disabled) holds leadership.
+func (h *Health) WatchBot(bot *Bot, elector *Elector) {
+	h.bot = bot
+	h.botElector = elector
+}
+
+// Liveness reports that the process is up and serving HTTP.
+func (h Health) Liveness(writer http.ResponseWriter, _ *http.Request) {
+	h.write(writer, http.StatusOK, HealthReport{Status: statusOK})
+}
+
+// Readiness checks the database, the freshness of fetched rates and the bot poller,
+// and answers 503 with a per-component breakdown if any of them is failing.
+// A process that does not lead the jobs checks the freshness of the rates stored
+// by the leader, and one that does not lead the bot skips it.
+func (h Health) Readiness(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"database": h.service.CheckDatabase,
+		"monitor":  h.checkStoredRates,
+	}
+
+	role := roleFollower
+
+	if h.runsJobs && h.jobsElector.IsLeader() {
+		role = roleLeader
+		checks["monitor"] = h.checkMonitor
+	}
+
+	if h.bot != nil && h.botElector.IsLeader() {
+		role = roleLeader
+		checks["bot"] = h.bot.Check
+	}
+
+	if !h.runsJobs && h.bot == nil {
+		role = ""
+	}
+
+	report := HealthReport{Status: statusOK, Role: role, Components: make(map[string]ComponentStatus, len(checks))}
+	code := http.StatusOK
+
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			report.Components[name] = ComponentStatus{Status: statusUnavailable, Error: err.Error()}
+			report.Status = statusUnavailable
+			code = http.StatusServiceUnavailable
+
+			continue
+		}
+
+		report.Components[name] = ComponentStatus{Status: statusOK}
+	}
+
+	h.write(writer, code, report)
+}
+
+// checkMonitor judges the leader by its own fetches. Until the first one, which
+// may be a whole interval after it started or took over, the rates stored before
+// stand in for them.
+func (h Health) checkMonitor(ctx context.Context) error {
+	if last := h.service.LastSuccessfulFetch(); !last.IsZero() {
+		return h.checkFresh(last)
+	}
+
+	return h.checkStoredRates(ctx)
+}
+
+func (h Health) checkStoredRates(ctx context.Context) error {
+	last, err := h.service.LastStoredUpdate(ctx)
+	if err != nil {
+		return fmt.Errorf("error in Health's method checkStoredRates: %w", err)
+	}
+
+	return h.checkFresh(last)
+}
+
+func (h Health) checkFresh(last time.Time) error {
+	if last.IsZero() {
+		return errNoFetchYet
+	}
+
+	conf := h.service.Config()
+	interval := conf.MonitorSchedule().Period(time.Now()) + conf.Jitter()
+
+	if age := time.Since(last); age > interval+fetchStalenessGrace {
+		return fmt.Errorf("%w: %s ago", errFetchStale, age.Round(time.Second))
+	}
+
+	return nil
+}
+
+func (h Health) write(writer http.ResponseWriter, code int, report HealthReport) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+
+	if err := json.NewEncoder(writer).Encode(&report); err != nil {
+		h.log.Error("error in Health's method write", slog.Any("error", err))
+	}
+}
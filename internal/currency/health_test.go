@@ -0,0 +1,146 @@
+package currency
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		pingErr    error
+		lastFetch  time.Time
+		lastStored time.Time
+		wantCode   int
+		wantStatus map[string]string
+	}{
+		{
+			name:      "ready",
+			lastFetch: time.Now().Add(-time.Minute),
+			wantCode:  http.StatusOK,
+			wantStatus: map[string]string{
+				"database": statusOK,
+				"monitor":  statusOK,
+			},
+		},
+		{
+			name:      "database unreachable",
+			pingErr:   ErrNoCurrencies,
+			lastFetch: time.Now(),
+			wantCode:  http.StatusServiceUnavailable,
+			wantStatus: map[string]string{
+				"database": statusUnavailable,
+				"monitor":  statusOK,
+			},
+		},
+		{
+			name:      "stale rates",
+			lastFetch: time.Now().Add(-2 * time.Hour),
+			wantCode:  http.StatusServiceUnavailable,
+			wantStatus: map[string]string{
+				"database": statusOK,
+				"monitor":  statusUnavailable,
+			},
+		},
+		{
+			name:       "restart with fresh rates",
+			lastStored: time.Now().Add(-time.Minute),
+			wantCode:   http.StatusOK,
+			wantStatus: map[string]string{
+				"database": statusOK,
+				"monitor":  statusOK,
+			},
+		},
+		{
+			name:       "restart with stale rates",
+			lastStored: time.Now().Add(-2 * time.Hour),
+			wantCode:   http.StatusServiceUnavailable,
+			wantStatus: map[string]string{
+				"database": statusOK,
+				"monitor":  statusUnavailable,
+			},
+		},
+		{
+			name:     "never fetched",
+			wantCode: http.StatusServiceUnavailable,
+			wantStatus: map[string]string{
+				"database": statusOK,
+				"monitor":  statusUnavailable,
+			},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			repo := new(MockRepo)
+			repo.On("Ping", mock.Anything).Return(testCase.pingErr)
+			repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency{
+				{CurrencyName: "BTC", CurrencyLastUpdate: testCase.lastStored},
+			}, nil)
+
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			conf := config.Default()
+			svc := NewService(repo, logger, &conf)
+
+			if !testCase.lastFetch.IsZero() {
+				svc.lastFetch.Store(testCase.lastFetch.UnixNano())
+			}
+
+			health := NewHealth(svc, logger)
+			health.WatchJobs(nil)
+
+			recorder := httptest.NewRecorder()
+			health.Readiness(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			var report HealthReport
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&report))
+
+			assert.Equal(t, testCase.wantCode, recorder.Code)
+
+			for component, status := range testCase.wantStatus {
+				assert.Equal(t, status, report.Components[component].Status, component)
+			}
+		})
+	}
+}
+
+func TestReadinessFollower(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("Ping", mock.Anything).Return(nil)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency{
+		{CurrencyName: "BTC", CurrencyLastUpdate: time.Now().Add(-time.Minute)},
+	}, nil)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	conf := config.Default()
+
+	// A follower never fetches itself, so it is ready on the rates stored by the leader.
+	health := NewHealth(NewService(repo, logger, &conf), logger)
+	health.WatchJobs(&Elector{})
+
+	recorder := httptest.NewRecorder()
+	health.Readiness(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report HealthReport
+	require.NoError(t, json.NewDecoder(recorder.Body).Decode(&report))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, roleFollower, report.Role)
+	assert.Equal(t, statusOK, report.Components["monitor"].Status)
+}
@@ -0,0 +1,353 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	IndicatorSMA       = "sma"
+	IndicatorEMA       = "ema"
+	IndicatorRSI       = "rsi"
+	IndicatorMACD      = "macd"
+	IndicatorBollinger = "bollinger"
+
+	defaultIndicatorInterval   = time.Hour
+	defaultIndicatorPeriod     = 20
+	defaultRSIPeriod           = 14
+	defaultBollingerDeviations = 2
+	// defaultIndicatorPoints is how many points are returned when from is not given.
+	defaultIndicatorPoints = 100
+	maxIndicatorPeriod     = 500
+	maxIndicatorCandles    = 10000
+
+	macdFast   = 12
+	macdSlow   = 26
+	macdSignal = 9
+)
+
+var (
+	errIndicatorType     = errors.New("type must be one of sma, ema, rsi, macd, bollinger")
+	errIndicatorPeriod   = errors.New("period must be between 2 and 500")
+	errIndicatorInterval = errors.New("interval must be at least a minute, such as 15m or 1h")
+	errIndicatorK        = errors.New("k must be greater than zero")
+	errIndicatorRange    = errors.New("from and to span more than 10000 intervals")
+)
+
+// Candle is the open, high, low and close price of a currency in the interval starting at Time.
+type Candle struct {
+	Time  time.Time       `json:"time"`
+	Open  decimal.Decimal `json:"open"`
+	High  decimal.Decimal `json:"high"`
+	Low   decimal.Decimal `json:"low"`
+	Close decimal.Decimal `json:"close"`
+}
+
+// IndicatorQuery selects an indicator and the candles it is computed from. Zero
+// fields take defaults: a period of 20 (14 for RSI), 1h candles, k of 2, to of now
+// and a from that yields 100 points.
+type IndicatorQuery struct {
+	Type     string
+	Period   int
+	Interval time.Duration
+	// K is the number of standard deviations between the Bollinger bands and the middle band.
+	K        float64
+	From, To time.Time
+}
+
+// IndicatorPoint holds the values of an indicator at the close of the candle starting at Time,
+// by name: sma, ema, rsi, macd/signal/histogram or middle/upper/lower.
+type IndicatorPoint struct {
+	Time   time.Time          `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
+
+type Indicator struct {
+	Currency string           `json:"currency"`
+	Type     string           `json:"type"`
+	Period   int              `json:"period,omitempty"`
+	Interval string           `json:"interval"`
+	Points   []IndicatorPoint `json:"points"`
+}
+
+// GetIndicator computes an indicator over the close prices of candles built from history.
+// Intervals without history have no candle and are skipped, not filled.
+func (s Service) GetIndicator(ctx context.Context, currencyName string, query IndicatorQuery) (Indicator, error) {
+	if err := query.normalize(time.Now()); err != nil {
+		return Indicator{}, fmt.Errorf("error in Service's method GetIndicator: %w", err)
+	}
+
+	candles, err := s.repository.SelectCandles(ctx, currencyName, query.Interval, query.From, query.To,
+		s.historyTiers(time.Now()))
+	if err != nil {
+		return Indicator{}, fmt.Errorf("error in Service's method GetIndicator: %w", err)
+	}
+
+	indicator := Indicator{
+		Currency: currencyName,
+		Type:     query.Type,
+		Period:   query.Period,
+		Interval: query.Interval.String(),
+		Points:   computeIndicator(query, candles),
+	}
+
+	if query.Type == IndicatorMACD {
+		indicator.Period = 0
+	}
+
+	return indicator, nil
+}
+
+// normalize fills in defaults relative to now and validates the query.
+func (q *IndicatorQuery) normalize(now time.Time) error {
+	var warmUp int
+
+	switch q.Type {
+	case IndicatorSMA, IndicatorEMA, IndicatorBollinger:
+		if q.Period == 0 {
+			q.Period = defaultIndicatorPeriod
+		}
+
+		warmUp = q.Period
+	case IndicatorRSI:
+		if q.Period == 0 {
+			q.Period = defaultRSIPeriod
+		}
+
+		warmUp = q.Period + 1
+	case IndicatorMACD:
+		q.Period = macdSlow
+		warmUp = macdSlow + macdSignal
+	default:
+		return fmt.Errorf("%w, got %q", errIndicatorType, q.Type)
+	}
+
+	if q.Period < 2 || q.Period > maxIndicatorPeriod {
+		return fmt.Errorf("%w, got %d", errIndicatorPeriod, q.Period)
+	}
+
+	if q.Interval == 0 {
+		q.Interval = defaultIndicatorInterval
+	}
+
+	if q.Interval < time.Minute {
+		return fmt.Errorf("%w, got %s", errIndicatorInterval, q.Interval)
+	}
+
+	if q.K == 0 {
+		q.K = defaultBollingerDeviations
+	}
+
+	if q.K < 0 || math.IsNaN(q.K) || math.IsInf(q.K, 0) {
+		return fmt.Errorf("%w, got %v", errIndicatorK, q.K)
+	}
+
+	if q.To.IsZero() {
+		q.To = now
+	}
+
+	if q.From.IsZero() {
+		q.From = q.To.Add(-time.Duration(warmUp+defaultIndicatorPoints) * q.Interval)
+	}
+
+	if q.From.After(q.To) {
+		return errInvalidTimeRange
+	}
+
+	if q.To.Sub(q.From)/q.Interval > maxIndicatorCandles {
+		return errIndicatorRange
+	}
+
+	return nil
+}
+
+func computeIndicator(query IndicatorQuery, candles []Candle) []IndicatorPoint {
+	closes := make([]float64, 0, len(candles))
+	for _, candle := range candles {
+		closes = append(closes, candle.Close.InexactFloat64())
+	}
+
+	series := make(map[string][]float64)
+
+	switch query.Type {
+	case IndicatorSMA:
+		series["sma"] = sma(closes, query.Period)
+	case IndicatorEMA:
+		series["ema"] = ema(closes, query.Period)
+	case IndicatorRSI:
+		series["rsi"] = rsi(closes, query.Period)
+	case IndicatorMACD:
+		fast, slow := ema(closes, macdFast), ema(closes, macdSlow)
+		line := make([]float64, len(closes))
+
+		for i := range closes {
+			line[i] = fast[i] - slow[i]
+		}
+
+		signal := ema(line, macdSignal)
+		histogram := make([]float64, len(closes))
+
+		for i := range closes {
+			histogram[i] = line[i] - signal[i]
+		}
+
+		series["macd"], series["signal"], series["histogram"] = line, signal, histogram
+	case IndicatorBollinger:
+		middle, deviation := sma(closes, query.Period), stddev(closes, query.Period)
+		upper, lower := make([]float64, len(closes)), make([]float64, len(closes))
+
+		for i := range closes {
+			upper[i] = middle[i] + query.K*deviation[i]
+			lower[i] = middle[i] - query.K*deviation[i]
+		}
+
+		series["middle"], series["upper"], series["lower"] = middle, upper, lower
+	}
+
+	points := make([]IndicatorPoint, 0, len(candles))
+
+	for i, candle := range candles {
+		values := make(map[string]float64, len(series))
+		complete := true
+
+		for name, value := range series {
+			if math.IsNaN(value[i]) {
+				complete = false
+
+				break
+			}
+
+			values[name] = value[i]
+		}
+
+		if complete {
+			points = append(points, IndicatorPoint{Time: candle.Time, Values: values})
+		}
+	}
+
+	return points
+}
+
+// sma is the simple moving average of period values, NaN until there are period values.
+func sma(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+
+	var sum float64
+
+	for i, value := range values {
+		sum += value
+		if i >= period {
+			sum -= values[i-period]
+		}
+
+		if i >= period-1 {
+			result[i] = sum / float64(period)
+		}
+	}
+
+	return result
+}
+
+// ema is the exponential moving average with a smoothing factor of 2/(period+1),
+// seeded with the simple average of the first period values. Leading NaNs are skipped.
+func ema(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+
+	start := 0
+	for start < len(values) && math.IsNaN(values[start]) {
+		start++
+	}
+
+	if len(values)-start < period {
+		return result
+	}
+
+	var seed float64
+	for _, value := range values[start : start+period] {
+		seed += value
+	}
+
+	alpha := 2 / float64(period+1)
+	result[start+period-1] = seed / float64(period)
+
+	for i := start + period; i < len(values); i++ {
+		result[i] = alpha*values[i] + (1-alpha)*result[i-1]
+	}
+
+	return result
+}
+
+// rsi is Wilder's relative strength index, from 0 to 100, NaN until there are period changes.
+// A series that did not move is neutral, 50.
+func rsi(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	if len(values) <= period {
+		return result
+	}
+
+	var gain, loss float64
+
+	for i := 1; i < len(values); i++ {
+		change := values[i] - values[i-1]
+		up, down := math.Max(change, 0), math.Max(-change, 0)
+
+		if i <= period {
+			gain += up / float64(period)
+			loss += down / float64(period)
+		} else {
+			gain = (gain*float64(period-1) + up) / float64(period)
+			loss = (loss*float64(period-1) + down) / float64(period)
+		}
+
+		if i < period {
+			continue
+		}
+
+		switch {
+		case gain == 0 && loss == 0:
+			result[i] = 50
+
+			continue
+		case loss == 0:
+			result[i] = 100
+
+			continue
+		}
+
+		result[i] = 100 - 100/(1+gain/loss)
+	}
+
+	return result
+}
+
+// stddev is the population standard deviation of period values, NaN until there are period values.
+func stddev(values []float64, period int) []float64 {
+	result := nanSeries(len(values))
+	means := sma(values, period)
+
+	for i := period - 1; i < len(values); i++ {
+		var sum float64
+
+		for _, value := range values[i-period+1 : i+1] {
+			sum += (value - means[i]) * (value - means[i])
+		}
+
+		result[i] = math.Sqrt(sum / float64(period))
+	}
+
+	return result
+}
+
+func nanSeries(length int) []float64 {
+	series := make([]float64, length)
+	for i := range series {
+		series[i] = math.NaN()
+	}
+
+	return series
+}
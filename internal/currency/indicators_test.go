@@ -0,0 +1,145 @@
+package currency
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndicatorSeries(t *testing.T) {
+	t.Parallel()
+
+	nan := math.NaN()
+
+	tests := []struct {
+		name string
+		got  []float64
+		want []float64
+	}{
+		{"sma", sma([]float64{1, 2, 3, 4, 5}, 3), []float64{nan, nan, 2, 3, 4}},
+		{"ema", ema([]float64{1, 2, 3, 4, 5}, 3), []float64{nan, nan, 2, 3, 4}},
+		{"ema skips leading NaN", ema([]float64{nan, 1, 2, 3, 4, 5}, 3), []float64{nan, nan, nan, 2, 3, 4}},
+		{"rsi", rsi([]float64{1, 2, 1, 2, 1}, 2), []float64{nan, nan, 50, 75, 37.5}},
+		{"rsi without losses", rsi([]float64{1, 2, 3}, 2), []float64{nan, nan, 100}},
+		{"rsi of a flat series", rsi([]float64{5, 5, 5, 5}, 2), []float64{nan, nan, 50, 50}},
+		{"rsi after a flat start", rsi([]float64{5, 5, 5, 6}, 2), []float64{nan, nan, 50, 100}},
+		{"stddev", stddev([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8), []float64{nan, nan, nan, nan, nan, nan, nan, 2}},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Len(t, testCase.got, len(testCase.want))
+
+			for i, want := range testCase.want {
+				if math.IsNaN(want) {
+					assert.True(t, math.IsNaN(testCase.got[i]), "index %d", i)
+
+					continue
+				}
+
+				assert.InDelta(t, want, testCase.got[i], 1e-9, "index %d", i)
+			}
+		})
+	}
+}
+
+func TestGetIndicator(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := make([]Candle, 40)
+
+	for i := range candles {
+		price := decimal.NewFromInt(100)
+		candles[i] = Candle{Time: start.Add(time.Duration(i) * time.Hour), Open: price, High: price, Low: price, Close: price}
+	}
+
+	repo := new(MockRepo)
+	repo.On("SelectCandles", mock.Anything, "BTC", time.Hour, mock.Anything, mock.Anything, mock.Anything).
+		Return(candles, nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	tests := []struct {
+		query      IndicatorQuery
+		wantPoints int
+		wantValues map[string]float64
+		wantErr    error
+	}{
+		{IndicatorQuery{Type: IndicatorSMA}, 21, map[string]float64{"sma": 100}, nil},
+		{IndicatorQuery{Type: IndicatorRSI, Period: 5}, 35, map[string]float64{"rsi": 50}, nil},
+		{
+			IndicatorQuery{Type: IndicatorMACD}, 7,
+			map[string]float64{"macd": 0, "signal": 0, "histogram": 0}, nil,
+		},
+		{
+			IndicatorQuery{Type: IndicatorBollinger, Period: 10, K: 3}, 31,
+			map[string]float64{"middle": 100, "upper": 100, "lower": 100}, nil,
+		},
+		{IndicatorQuery{Type: "wma"}, 0, nil, errIndicatorType},
+		{IndicatorQuery{Type: IndicatorEMA, Period: 1}, 0, nil, errIndicatorPeriod},
+		{IndicatorQuery{Type: IndicatorEMA, Interval: time.Second}, 0, nil, errIndicatorInterval},
+		{
+			IndicatorQuery{Type: IndicatorEMA, From: start, To: start.AddDate(10, 0, 0)}, 0, nil,
+			errIndicatorRange,
+		},
+	}
+
+	for i, testCase := range tests {
+		t.Run(testCase.query.Type+strconv.Itoa(i), func(t *testing.T) {
+			t.Parallel()
+
+			indicator, err := svc.GetIndicator(context.Background(), "BTC", testCase.query)
+			require.ErrorIs(t, err, testCase.wantErr)
+
+			if testCase.wantErr != nil {
+				return
+			}
+
+			require.Len(t, indicator.Points, testCase.wantPoints)
+			assert.Equal(t, candles[len(candles)-1].Time, indicator.Points[len(indicator.Points)-1].Time)
+			assert.Equal(t, testCase.wantValues, indicator.Points[0].Values)
+			assert.Equal(t, "1h0m0s", indicator.Interval)
+		})
+	}
+}
+
+func TestGetIndicatorRSI(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	closes := []int64{1, 2, 1, 2, 1}
+	candles := make([]Candle, 0, len(closes))
+
+	for i, value := range closes {
+		price := decimal.NewFromInt(value)
+		candles = append(candles, Candle{
+			Time: start.Add(time.Duration(i) * time.Hour), Open: price, High: price, Low: price, Close: price,
+		})
+	}
+
+	repo := new(MockRepo)
+	repo.On("SelectCandles", mock.Anything, "BTC", time.Hour, mock.Anything, mock.Anything, mock.Anything).
+		Return(candles, nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	indicator, err := svc.GetIndicator(context.Background(), "BTC", IndicatorQuery{Type: IndicatorRSI, Period: 2})
+	require.NoError(t, err)
+	require.Len(t, indicator.Points, 3)
+
+	for i, want := range []float64{50, 75, 37.5} {
+		assert.InDelta(t, want, indicator.Points[i].Values["rsi"], 1e-9, "point %d", i)
+	}
+}
@@ -0,0 +1,151 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Elector decides which replica runs the scheduled jobs and the bot. The leader
+// holds a session-level Postgres advisory lock on a connection taken out of the
+// pool, so the lock is released as soon as that connection or the process dies.
+type Elector struct {
+	lock    advisoryLock
+	key     int64
+	retry   time.Duration
+	log     *slog.Logger
+	leading atomic.Bool
+}
+
+// NewElector creates an elector competing for the advisory lock key on the
+// repository's database. retry is both how often a follower tries to take
+// the lock and how often the leader checks that it still holds it.
+func NewElector(repository *Repository, key int64, retry time.Duration, log *slog.Logger) *Elector {
+	return &Elector{lock: poolLock{pool: repository.pool}, key: key, retry: retry, log: log}
+}
+
+// advisoryLock takes a session-level lock; it is held until the session is closed.
+type advisoryLock interface {
+	// tryLock returns a nil session if another session holds the lock.
+	tryLock(ctx context.Context, key int64) (lockSession, error)
+}
+
+type lockSession interface {
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+type poolLock struct {
+	pool *pgxpool.Pool
+}
+
+func (l poolLock) tryLock(ctx context.Context, key int64) (lockSession, error) {
+	pooled, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire a connection: %w", err)
+	}
+
+	// The lock belongs to the session, so the connection must never go back to the pool.
+	conn := pooled.Hijack()
+
+	var acquired bool
+
+	err = conn.QueryRow(ctx, "select pg_try_advisory_lock($1)", key).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close(context.Background())
+
+		if err != nil {
+			return nil, fmt.Errorf("could not try the lock: %w", err)
+		}
+
+		return nil, nil
+	}
+
+	return conn, nil
+}
+
+// IsLeader reports whether this replica currently holds the lock. A nil
+// elector, used when election is disabled, always leads.
+func (e *Elector) IsLeader() bool {
+	return e == nil || e.leading.Load()
+}
+
+// Run competes for leadership until ctx is done. Whenever this replica becomes
+// the leader it calls lead with a context that is cancelled when leadership is
+// lost or ctx is done, and waits for lead to return before letting go of the lock.
+// A nil elector calls lead right away.
+func (e *Elector) Run(ctx context.Context, lead func(context.Context)) {
+	if e == nil {
+		lead(ctx)
+
+		return
+	}
+
+	for {
+		e.tryLead(ctx, lead)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retry):
+		}
+	}
+}
+
+func (e *Elector) tryLead(ctx context.Context, lead func(context.Context)) {
+	conn, err := e.lock.tryLock(ctx, e.key)
+	if err != nil {
+		e.log.Warn("leader election failed", slog.Any("error", err))
+
+		return
+	}
+
+	if conn == nil {
+		return
+	}
+
+	defer conn.Close(context.Background())
+
+	e.leading.Store(true)
+	defer e.leading.Store(false)
+
+	e.log.Info("acquired leadership", slog.Int64("lockKey", e.key))
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		lead(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+
+			e.log.Info("released leadership")
+
+			return
+		case <-ticker.C:
+			if err := conn.Ping(ctx); err != nil && ctx.Err() == nil {
+				e.log.Error("lost leadership", slog.Any("error", err))
+				cancel()
+				<-done
+
+				return
+			}
+		}
+	}
+}
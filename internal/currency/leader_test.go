@@ -0,0 +1,187 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnectionLost = errors.New("connection lost")
+
+// fakeLock is an advisory lock shared by the electors of a test.
+type fakeLock struct {
+	mu     sync.Mutex
+	holder *fakeSession
+}
+
+type fakeSession struct {
+	lock *fakeLock
+	mu   sync.Mutex
+	lost bool
+}
+
+func (l *fakeLock) tryLock(_ context.Context, _ int64) (lockSession, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.holder != nil {
+		return nil, nil
+	}
+
+	l.holder = &fakeSession{lock: l}
+
+	return l.holder, nil
+}
+
+func (l *fakeLock) session() *fakeSession {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.holder
+}
+
+func (s *fakeSession) Ping(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lost {
+		return errConnectionLost
+	}
+
+	return nil
+}
+
+func (s *fakeSession) Close(_ context.Context) error {
+	s.lock.mu.Lock()
+	defer s.lock.mu.Unlock()
+
+	if s.lock.holder == s {
+		s.lock.holder = nil
+	}
+
+	return nil
+}
+
+func (s *fakeSession) lose() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lost = true
+}
+
+func newTestElector(lock *fakeLock) *Elector {
+	return &Elector{lock: lock, key: 1, retry: 10 * time.Millisecond, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+// runElector runs elector and reports on leading each time it starts or stops leading.
+func runElector(ctx context.Context, elector *Elector, leading chan<- bool) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		elector.Run(ctx, func(ctx context.Context) {
+			leading <- true
+			<-ctx.Done()
+			leading <- false
+		})
+	}()
+
+	return done
+}
+
+func TestElectorLeadsAndReleases(t *testing.T) {
+	t.Parallel()
+
+	lock := &fakeLock{}
+	elector := newTestElector(lock)
+	leading := make(chan bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runElector(ctx, elector, leading)
+
+	require.True(t, <-leading)
+	assert.True(t, elector.IsLeader())
+
+	cancel()
+
+	require.False(t, <-leading)
+	<-done
+	assert.False(t, elector.IsLeader())
+	assert.Nil(t, lock.session(), "the lock is released after lead returned")
+}
+
+func TestElectorStopsLeadingWhenLockIsLost(t *testing.T) {
+	t.Parallel()
+
+	lock := &fakeLock{}
+	leading := make(chan bool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runElector(ctx, newTestElector(lock), leading)
+
+	require.True(t, <-leading)
+
+	lock.session().lose()
+
+	// Leadership ends and, once the dead session is closed, is won again.
+	require.False(t, <-leading)
+	require.True(t, <-leading)
+
+	cancel()
+	<-leading
+}
+
+func TestElectorHandsOverLeadership(t *testing.T) {
+	t.Parallel()
+
+	lock := &fakeLock{}
+	first, second := newTestElector(lock), newTestElector(lock)
+	firstLeading, secondLeading := make(chan bool), make(chan bool)
+
+	firstCtx, stopFirst := context.WithCancel(context.Background())
+	firstDone := runElector(firstCtx, first, firstLeading)
+
+	require.True(t, <-firstLeading)
+
+	secondCtx, stopSecond := context.WithCancel(context.Background())
+	defer stopSecond()
+
+	runElector(secondCtx, second, secondLeading)
+
+	// The follower keeps retrying while the leader holds the lock.
+	time.Sleep(5 * second.retry)
+	assert.False(t, second.IsLeader())
+
+	stopFirst()
+
+	require.False(t, <-firstLeading)
+	<-firstDone
+	require.True(t, <-secondLeading)
+	assert.True(t, second.IsLeader())
+
+	stopSecond()
+	<-secondLeading
+}
+
+func TestNilElectorAlwaysLeads(t *testing.T) {
+	t.Parallel()
+
+	var elector *Elector
+
+	called := false
+
+	elector.Run(context.Background(), func(context.Context) { called = true })
+
+	assert.True(t, called)
+	assert.True(t, elector.IsLeader())
+}
@@ -0,0 +1,287 @@
+package currency
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gopkg.in/telebot.v3"
+)
+
+const (
+	metricsNamespace = "currency"
+
+	fetchResultSuccess = "success"
+	fetchResultFailure = "failure"
+)
+
+//nolint:gochecknoglobals
+var (
+	providerFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_fetch_duration_seconds",
+		Help:      "Latency of rate requests to the provider.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"provider"})
+
+	providerFetchesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_fetches_total",
+		Help:      "Rate requests to the provider by result.",
+	}, []string{"provider", "result"})
+
+	currencyPriceGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "price",
+		Help:      "Last stored price of a currency.",
+	}, []string{"currency"})
+
+	repositoryQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "repository_query_duration_seconds",
+		Help:      "Duration of repository queries by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	botCommandsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "bot_commands_total",
+		Help:      "Telegram bot commands handled.",
+	}, []string{"command"})
+
+	quarantinedQuotesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "quarantined_quotes_total",
+		Help:      "Fetched prices held back as anomalies, by currency.",
+	}, []string{"currency"})
+
+	historyRetentionRowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "history_retention_rows_total",
+		Help:      "History and webhook delivery rows rolled up or deleted by the retention job, by operation.",
+	}, []string{"operation"})
+
+	cacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_requests_total",
+		Help:      "Reads of the cached currencies by result: hit, stale or miss.",
+	}, []string{"result"})
+
+	cacheRefreshesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_refreshes_total",
+		Help:      "Loads of the cached currencies by reason: update, expired or watch.",
+	}, []string{"reason"})
+
+	eventsPublishedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_published_total",
+		Help:      "Events published on the event bus by type.",
+	}, []string{"event"})
+
+	eventsDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_dropped_total",
+		Help:      "Events not delivered to a subscriber whose buffer was full, by type.",
+	}, []string{"event"})
+
+	webhookDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by resulting status: delivered, pending (to be retried) or failed.",
+	}, []string{"status"})
+
+	lastUpdates = newLastUpdateCollector()
+)
+
+// lastUpdateCollector reports how long ago each currency was stored. The age is
+// computed at scrape time, so it keeps growing while fetches are failing.
+type lastUpdateCollector struct {
+	mu      sync.Mutex
+	updates map[string]time.Time
+	desc    *prometheus.Desc
+}
+
+func newLastUpdateCollector() *lastUpdateCollector {
+	collector := &lastUpdateCollector{
+		updates: make(map[string]time.Time),
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "last_update_age_seconds"),
+			"Seconds since the price of a currency was last stored.",
+			[]string{"currency"}, nil,
+		),
+	}
+
+	prometheus.MustRegister(collector)
+
+	return collector
+}
+
+func (c *lastUpdateCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.desc
+}
+
+func (c *lastUpdateCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, updated := range c.updates {
+		metrics <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Since(updated).Seconds(), name)
+	}
+}
+
+func (c *lastUpdateCollector) set(name string, updated time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.updates[name] = updated
+}
+
+func observeCurrencies(currencies []Currency) {
+	for _, currency := range currencies {
+		currencyPriceGauge.WithLabelValues(currency.CurrencyName).Set(currency.CurrencyPrice.InexactFloat64())
+		lastUpdates.set(currency.CurrencyName, currency.CurrencyLastUpdate)
+	}
+}
+
+func observeQuarantine(currency string) {
+	quarantinedQuotesTotal.WithLabelValues(currency).Inc()
+}
+
+func observeRetention(operation string, rows int64) {
+	historyRetentionRowsTotal.WithLabelValues(operation).Add(float64(rows))
+}
+
+func observeCache(result string) {
+	cacheRequestsTotal.WithLabelValues(result).Inc()
+}
+
+func observeCacheRefresh(reason string) {
+	cacheRefreshesTotal.WithLabelValues(reason).Inc()
+}
+
+func observeEvent(event string) {
+	eventsPublishedTotal.WithLabelValues(event).Inc()
+}
+
+func observeDroppedEvent(event string) {
+	eventsDroppedTotal.WithLabelValues(event).Inc()
+}
+
+func observeWebhookDelivery(status string) {
+	webhookDeliveriesTotal.WithLabelValues(status).Inc()
+}
+
+func observeFetch(provider string, started time.Time, err error) {
+	providerFetchDuration.WithLabelValues(provider).Observe(time.Since(started).Seconds())
+
+	result := fetchResultSuccess
+	if err != nil {
+		result = fetchResultFailure
+	}
+
+	providerFetchesTotal.WithLabelValues(provider, result).Inc()
+}
+
+// observeQuery is deferred at the top of a repository method:
+//
+//	defer observeQuery("SelectCurrency")()
+func observeQuery(method string) func() {
+	started := time.Now()
+
+	return func() {
+		repositoryQueryDuration.WithLabelValues(method).Observe(time.Since(started).Seconds())
+	}
+}
+
+// CountCommand is a telebot middleware that counts handled bot commands.
+func CountCommand(command string) telebot.MiddlewareFunc {
+	return func(next telebot.HandlerFunc) telebot.HandlerFunc {
+		return func(ctx telebot.Context) error {
+			botCommandsTotal.WithLabelValues(command).Inc()
+
+			return next(ctx)
+		}
+	}
+}
+
+// MetricsMiddleware counts HTTP requests by their mux route template, so that
+// /rates/BTC and /rates/ETH are reported as a single /rates/{name} series.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, request)
+
+		route := request.URL.Path
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		httpRequestsTotal.WithLabelValues(route, request.Method, strconv.Itoa(recorder.status)).Inc()
+	})
+}
+
+// statusRecorder remembers the status code and passes flushing and hijacking
+// through, which the event stream and the WebSocket endpoint rely on.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+
+	return r.ResponseWriter.Write(data) //nolint:wrapcheck
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	conn, readWriter, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in statusRecorder's method Hijack: %w", err)
+	}
+
+	r.status = http.StatusSwitchingProtocols
+
+	return conn, readWriter, nil
+}
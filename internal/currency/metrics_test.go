@@ -0,0 +1,59 @@
+package currency
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var errFetch = errors.New("provider unavailable")
+
+func TestLastUpdateCollector(t *testing.T) {
+	t.Parallel()
+
+	// A separate collector, since the global one is registered once.
+	collector := &lastUpdateCollector{updates: make(map[string]time.Time), desc: lastUpdates.desc}
+
+	assert.Equal(t, 0, testutil.CollectAndCount(collector))
+
+	collector.set("BTC", time.Now().Add(-90*time.Second))
+
+	// The age is computed at scrape time.
+	assert.GreaterOrEqual(t, testutil.ToFloat64(collector), 90.0)
+}
+
+func TestObserveFetch(t *testing.T) {
+	t.Parallel()
+
+	observeFetch("metrics-test", time.Now(), nil)
+	observeFetch("metrics-test", time.Now(), errFetch)
+	observeFetch("metrics-test", time.Now(), errFetch)
+
+	assert.InDelta(t, 1, testutil.ToFloat64(providerFetchesTotal.WithLabelValues("metrics-test", fetchResultSuccess)), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(providerFetchesTotal.WithLabelValues("metrics-test", fetchResultFailure)), 0)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	t.Parallel()
+
+	router := mux.NewRouter()
+	router.Use(MetricsMiddleware)
+	router.HandleFunc("/metrics-test/{name}", func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusTeapot)
+		writer.WriteHeader(http.StatusOK)
+	})
+
+	for _, name := range []string{"BTC", "ETH"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/"+name, nil))
+	}
+
+	// Requests are counted by route template and by the first status written.
+	assert.InDelta(t, 2,
+		testutil.ToFloat64(httpRequestsTotal.WithLabelValues("/metrics-test/{name}", http.MethodGet, "418")), 0)
+}
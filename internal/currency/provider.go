@@ -0,0 +1,38 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+)
+
+var errUnknownProvider = errors.New("unknown rate provider")
+
+// Quote is the price of a provider pair such as BTCRUB, as the provider formatted it.
+// Time is when the provider quoted the price, or zero if the provider does not say.
+type Quote struct {
+	Pair  string
+	Price string
+	Time  time.Time
+}
+
+// RateProvider fetches current exchange rates from an external service.
+type RateProvider interface {
+	Name() string
+	FetchRates(ctx context.Context, pairs []string) ([]Quote, error)
+}
+
+// NewRateProvider creates the provider selected in conf.Provider.
+func NewRateProvider(conf *config.Config) (RateProvider, error) {
+	switch conf.Provider.Name {
+	case config.ProviderCurrate:
+		timeout := time.Duration(conf.Provider.Timeout) * time.Second
+
+		return NewCurrateProvider(conf.Provider.URL, conf.APIKey, timeout), nil
+	default:
+		return nil, fmt.Errorf("error in NewRateProvider: %w: %q", errUnknownProvider, conf.Provider.Name)
+	}
+}
@@ -2,10 +2,21 @@ package currency
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// historyBatchSize bounds the number of statements sent in one batch by InsertHistory.
+	historyBatchSize = 1000
+
+	currencyColumns = `id, currency_name, price, price_min, price_max, changes_per_hour, last_update, quoted_at`
 )
 
 func NewRepository(dsn string) (*Repository, error) {
@@ -14,29 +25,60 @@ func NewRepository(dsn string) (*Repository, error) {
 		return nil, fmt.Errorf("error in Repository's method NewRepository: %w", err)
 	}
 
-	return &Repository{conn: conn}, nil
+	return &Repository{pool: conn, conn: conn}, nil
 }
 
 type Repository struct {
-	conn *pgxpool.Pool
+	pool *pgxpool.Pool
+	// conn is the pool, or the transaction of a Repository passed to InTx.
+	conn querier
+}
+
+// querier is what the queries need from a pool or a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, batch *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Close waits for acquired connections to be released and closes the pool.
+func (r Repository) Close() {
+	r.pool.Close()
+}
+
+// InTx calls fn with a repository whose queries run in one transaction, which
+// is committed if fn returns nil and rolled back otherwise. Inside a transaction
+// it uses a savepoint.
+func (r Repository) InTx(ctx context.Context, fn func(RepositoryInterface) error) error {
+	err := pgx.BeginFunc(ctx, r.conn, func(tx pgx.Tx) error {
+		return fn(Repository{pool: r.pool, conn: tx})
+	})
+	if err != nil {
+		return fmt.Errorf("error in Repository's method InTx: %w", err)
+	}
+
+	return nil
 }
 
 func (r Repository) SelectAllCurrencies(ctx context.Context) ([]Currency, error) {
+	defer observeQuery("SelectAllCurrencies")()
+
 	var currencies []Currency
 
-	query := "select * from currency"
+	query := "select " + currencyColumns + " from currency order by currency_name"
 
 	rows, err := r.conn.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error in Repository's method SelectCurrencies: %w", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var currency Currency
 
-		err := rows.Scan(&currency.CurrencyID, &currency.CurrencyName, &currency.CurrencyPrice, &currency.CurrencyMinPrice,
-			&currency.CurrencyMaxPrice, &currency.CurrencyChangePerHour, &currency.CurrencyLastUpdate)
-		if err != nil {
+		if err := scanCurrency(rows, &currency); err != nil {
 			return nil, fmt.Errorf("error in Repository's method SelectAllCurrensies: %w", err)
 		}
 
@@ -47,25 +89,45 @@ func (r Repository) SelectAllCurrencies(ctx context.Context) ([]Currency, error)
 }
 
 func (r Repository) SelectCurrency(ctx context.Context, name string) (*Currency, error) {
+	defer observeQuery("SelectCurrency")()
+
 	var currency Currency
 
-	query := "select * from currency where currency_name = $1"
+	query := "select " + currencyColumns + " from currency where currency_name = $1"
 
-	err := r.conn.QueryRow(ctx, query, name).Scan(&currency.CurrencyID, &currency.CurrencyName, &currency.CurrencyPrice,
-		&currency.CurrencyMinPrice, &currency.CurrencyMaxPrice, &currency.CurrencyChangePerHour,
-		&currency.CurrencyLastUpdate)
-	if err != nil {
+	if err := scanCurrency(r.conn.QueryRow(ctx, query, name), &currency); err != nil {
 		return nil, fmt.Errorf("error in Repository's method SelectCurrency: %w", err)
 	}
 
 	return &currency, nil
 }
 
+// scanCurrency scans a row of currencyColumns. Times are returned in UTC.
+func scanCurrency(row pgx.Row, currency *Currency) error {
+	err := row.Scan(&currency.CurrencyID, &currency.CurrencyName, &currency.CurrencyPrice, &currency.CurrencyMinPrice,
+		&currency.CurrencyMaxPrice, &currency.CurrencyChangePerHour, &currency.CurrencyLastUpdate,
+		&currency.CurrencyQuotedAt)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	currency.CurrencyLastUpdate = currency.CurrencyLastUpdate.UTC()
+	currency.CurrencyQuotedAt = currency.CurrencyQuotedAt.UTC()
+
+	return nil
+}
+
 func (r Repository) InsertCurrencies(ctx context.Context, currencies []Currency) ([]Currency, error) {
-	query := `insert into currency (currency_name, price, price_min, price_max, changes_per_hour) 
-				values (@currencyName, @price, @priceMin, @priceMax, @changesPerHour) on conflict (currency_name) do update set
-				currency_name=@currencyName, price=@price, price_min=@priceMin, price_max=@priceMax, 
-				changes_per_hour=@changesPerHour, last_update=now()`
+	defer observeQuery("InsertCurrencies")()
+
+	query := `insert into currency (currency_name, price, price_min, price_max, changes_per_hour, last_update, quoted_at)
+				values (@currencyName, @price, @priceMin, @priceMax, @changesPerHour, @lastUpdate, @quotedAt)
+				on conflict (currency_name) do update set
+				currency_name=@currencyName, price=@price, price_min=@priceMin, price_max=@priceMax,
+				changes_per_hour=@changesPerHour, last_update=@lastUpdate, quoted_at=@quotedAt`
+	historyQuery := `insert into currency_history (currency_name, price, created_at, ingested_at)
+				values (@currencyName, @price, @quotedAt, @lastUpdate)
+				on conflict (currency_name, created_at) do nothing`
 	batch := &pgx.Batch{}
 
 	for _, currency := range currencies {
@@ -75,38 +137,47 @@ func (r Repository) InsertCurrencies(ctx context.Context, currencies []Currency)
 			"priceMin":       currency.CurrencyMinPrice,
 			"priceMax":       currency.CurrencyMaxPrice,
 			"changesPerHour": currency.CurrencyChangePerHour,
+			"lastUpdate":     currency.CurrencyLastUpdate,
+			"quotedAt":       currency.CurrencyQuotedAt,
 		}
 
 		batch.Queue(query, args)
+		batch.Queue(historyQuery, args)
 	}
 
 	results := r.conn.SendBatch(ctx, batch)
 	defer results.Close()
 
 	for _, currency := range currencies {
-		_, err := results.Exec()
-		if err != nil {
-			return nil, fmt.Errorf("error to add %s in Repository's method InsertCurrencies %w", currency.CurrencyName, err)
+		for range 2 {
+			_, err := results.Exec()
+			if err != nil {
+				return nil, fmt.Errorf("error to add %s in Repository's method InsertCurrencies %w", currency.CurrencyName, err)
+			}
 		}
 	}
 
 	return currencies, nil
 }
 
-func (r Repository) SelectChangesPerHour(ctx context.Context, curr string) (float64, error) {
-	var currencyPerHour float64
+func (r Repository) SelectChangesPerHour(ctx context.Context, curr string) (decimal.Decimal, error) {
+	defer observeQuery("SelectChangesPerHour")()
+
+	var currencyPerHour decimal.Decimal
 
 	query := "select changes_per_hour from currency where currency_name = $1"
 
 	err := r.conn.QueryRow(ctx, query, curr).Scan(&currencyPerHour)
 	if err != nil {
-		return -1, fmt.Errorf("error in Repository's method SelectChangesPerHour %w", err)
+		return decimal.Zero, fmt.Errorf("error in Repository's method SelectChangesPerHour %w", err)
 	}
 
 	return currencyPerHour, nil
 }
 
 func (r Repository) SetChangesPerHour(ctx context.Context, currencies []Currency) error {
+	defer observeQuery("SetChangesPerHour")()
+
 	query := `update currency set changes_per_hour=@changesPerHour where currency_name=@currencyName`
 
 	batch := &pgx.Batch{}
@@ -131,3 +202,820 @@ func (r Repository) SetChangesPerHour(ctx context.Context, currencies []Currency
 
 	return nil
 }
+
+// SelectHistory returns the prices of a currency between from and to, oldest
+// first. Where tiers say raw ticks were deleted, every hourly and then daily
+// aggregate stands in with its close price, timed and ingested at its close.
+func (r Repository) SelectHistory(
+	ctx context.Context, name string, from, to time.Time, tiers HistoryTiers,
+) ([]HistoryRecord, error) {
+	defer observeQuery("SelectHistory")()
+
+	var history []HistoryRecord
+
+	// The tiers are split by close_at, so that no price is returned twice.
+	query := `select currency_name, price, created_at, ingested_at from currency_history
+				where currency_name = $1 and created_at >= greatest($2::timestamptz, $4::timestamptz)
+					and created_at <= $3
+				union all
+				select currency_name, close, close_at, close_at from currency_history_hourly
+				where currency_name = $1 and close_at >= greatest($2::timestamptz, $5::timestamptz)
+					and close_at < $4 and close_at <= $3
+				union all
+				select currency_name, close, close_at, close_at from currency_history_daily
+				where currency_name = $1 and close_at >= $2 and close_at < $5 and close_at <= $3
+				order by 3`
+
+	rows, err := r.conn.Query(ctx, query, name, from, to, tiers.Raw, tiers.Hourly)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectHistory: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record HistoryRecord
+
+		err := rows.Scan(&record.CurrencyName, &record.CurrencyPrice, &record.CreatedAt, &record.IngestedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectHistory: %w", err)
+		}
+
+		record.CreatedAt = record.CreatedAt.UTC()
+		record.IngestedAt = record.IngestedAt.UTC()
+
+		history = append(history, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectHistory: %w", err)
+	}
+
+	return history, nil
+}
+
+// SelectExtremes returns the min and max prices of a currency in each window
+// that has history, in the order of windows. Besides raw ticks it reads the
+// hourly and daily aggregates that start in a window, so that windows reaching
+// past the raw retention still see their extremes, timed at the start of the bucket.
+func (r Repository) SelectExtremes(
+	ctx context.Context, name string, windows []ExtremeWindow,
+) ([]WindowExtremes, error) {
+	defer observeQuery("SelectExtremes")()
+
+	labels := make([]string, 0, len(windows))
+	since := make([]time.Time, 0, len(windows))
+
+	for _, window := range windows {
+		labels = append(labels, window.Name)
+		since = append(since, window.Since)
+	}
+
+	query := `select w.label, mn.price, mn.created_at, mx.price, mx.created_at
+				from unnest($2::text[], $3::timestamptz[]) with ordinality as w(label, since, position)
+				cross join lateral (select price, created_at from (
+						select price, created_at from currency_history where currency_name = $1 and created_at >= w.since
+						union all
+						select low, bucket from currency_history_hourly where currency_name = $1 and bucket >= w.since
+						union all
+						select low, bucket from currency_history_daily where currency_name = $1 and bucket >= w.since
+					) prices order by price, created_at desc limit 1) mn
+				cross join lateral (select price, created_at from (
+						select price, created_at from currency_history where currency_name = $1 and created_at >= w.since
+						union all
+						select high, bucket from currency_history_hourly where currency_name = $1 and bucket >= w.since
+						union all
+						select high, bucket from currency_history_daily where currency_name = $1 and bucket >= w.since
+					) prices order by price desc, created_at desc limit 1) mx
+				order by w.position`
+
+	rows, err := r.conn.Query(ctx, query, name, labels, since)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectExtremes: %w", err)
+	}
+	defer rows.Close()
+
+	var extremes []WindowExtremes
+
+	for rows.Next() {
+		var window WindowExtremes
+
+		err := rows.Scan(&window.Window, &window.Min.Price, &window.Min.At, &window.Max.Price, &window.Max.At)
+		if err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectExtremes: %w", err)
+		}
+
+		window.Min.At = window.Min.At.UTC()
+		window.Max.At = window.Max.At.UTC()
+		extremes = append(extremes, window)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectExtremes: %w", err)
+	}
+
+	return extremes, nil
+}
+
+// SelectCandles aggregates the history of a currency between from and to into
+// candles of interval, aligned to multiples of interval since 2000-01-01 UTC.
+// Intervals without history have no candle. Before tiers.Raw the candles are
+// built from the hourly aggregates, and before tiers.Hourly from the daily ones,
+// whose buckets go to the candle of their first price.
+func (r Repository) SelectCandles(
+	ctx context.Context, name string, interval time.Duration, from, to time.Time, tiers HistoryTiers,
+) ([]Candle, error) {
+	defer observeQuery("SelectCandles")()
+
+	// A bucket that straddles a tier boundary overlaps the next tier, which open,
+	// high, low and close tolerate.
+	query := `with prices as (
+					select created_at as open_at, price as open, price as high, price as low,
+						price as close, created_at as close_at
+					from currency_history where currency_name = $1
+						and created_at >= greatest($3::timestamptz, $5::timestamptz) and created_at <= $4
+					union all
+					select open_at, open, high, low, close, close_at from currency_history_hourly
+					where currency_name = $1
+						and bucket >= greatest($3::timestamptz, $6::timestamptz) and bucket < $5 and bucket <= $4
+					union all
+					select open_at, open, high, low, close, close_at from currency_history_daily
+					where currency_name = $1 and bucket >= $3 and bucket < $6 and bucket <= $4
+				)
+				select date_bin($2::bigint * interval '1 microsecond', open_at, timestamptz '2000-01-01 00:00:00+00')
+					as bucket,
+				(array_agg(open order by open_at))[1], max(high), min(low),
+				(array_agg(close order by close_at desc))[1]
+				from prices group by bucket order by bucket`
+
+	rows, err := r.conn.Query(ctx, query, name, interval.Microseconds(), from, to, tiers.Raw, tiers.Hourly)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectCandles: %w", err)
+	}
+	defer rows.Close()
+
+	var candles []Candle
+
+	for rows.Next() {
+		var candle Candle
+
+		if err := rows.Scan(&candle.Time, &candle.Open, &candle.High, &candle.Low, &candle.Close); err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectCandles: %w", err)
+		}
+
+		candle.Time = candle.Time.UTC()
+		candles = append(candles, candle)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectCandles: %w", err)
+	}
+
+	return candles, nil
+}
+
+// InsertHistory adds records to the history and returns how many were new.
+// A record whose currency and time are already stored is skipped, and so is one
+// before rawBefore whose day is already rolled up: its tick may have been rolled
+// up and deleted, and rolling it up again would count it twice.
+func (r Repository) InsertHistory(ctx context.Context, records []HistoryRecord, rawBefore time.Time) (int64, error) {
+	defer observeQuery("InsertHistory")()
+
+	query := `insert into currency_history (currency_name, price, created_at, ingested_at)
+				select $1::text, $2::numeric, $3::timestamptz, $4::timestamptz where $3 >= $5::timestamptz or not exists (
+					select 1 from currency_history_daily where currency_name = $1 and bucket = date_trunc('day', $3, 'UTC'))
+				on conflict (currency_name, created_at) do nothing`
+
+	var inserted int64
+
+	for start := 0; start < len(records); start += historyBatchSize {
+		chunk := records[start:min(start+historyBatchSize, len(records))]
+		batch := &pgx.Batch{}
+
+		for _, record := range chunk {
+			batch.Queue(query, record.CurrencyName, record.CurrencyPrice, record.CreatedAt, record.IngestedAt, rawBefore)
+		}
+
+		results := r.conn.SendBatch(ctx, batch)
+
+		for _, record := range chunk {
+			tag, err := results.Exec()
+			if err != nil {
+				results.Close()
+
+				return inserted, fmt.Errorf("error to add %s at %s in Repository's method InsertHistory: %w",
+					record.CurrencyName, record.CreatedAt.Format(time.RFC3339), err)
+			}
+
+			inserted += tag.RowsAffected()
+		}
+
+		if err := results.Close(); err != nil {
+			return inserted, fmt.Errorf("error in Repository's method InsertHistory: %w", err)
+		}
+	}
+
+	return inserted, nil
+}
+
+// RecomputeExtremes widens the min/max prices of the named currencies to cover
+// their whole history. A currency that was never fetched gets a row with its
+// latest historical price and time.
+func (r Repository) RecomputeExtremes(ctx context.Context, names []string) error {
+	defer observeQuery("RecomputeExtremes")()
+
+	query := `insert into currency (currency_name, price, price_min, price_max, quoted_at)
+				select currency_name,
+					(array_agg(price order by created_at desc))[1], min(price), max(price), max(created_at)
+				from currency_history where currency_name = any($1) group by currency_name
+				on conflict (currency_name) do update set
+				price_min = least(currency.price_min, excluded.price_min),
+				price_max = greatest(currency.price_max, excluded.price_max)`
+
+	if _, err := r.conn.Exec(ctx, query, names); err != nil {
+		return fmt.Errorf("error in Repository's method RecomputeExtremes: %w", err)
+	}
+
+	return nil
+}
+
+// rollupQuery merges up to $1 raw ticks that are not rolled up yet into the
+// hourly and daily aggregates, marks them rolled up and returns their number.
+// Buckets are UTC hours and days.
+const rollupQuery = `with batch as (
+		update currency_history set rolled_up = true
+		where id in (select id from currency_history where not rolled_up order by id limit $1)
+		returning currency_name, price, created_at
+	), hourly as (
+		insert into currency_history_hourly as b
+			(currency_name, bucket, open, open_at, high, low, close, close_at, samples)
+		select currency_name, date_trunc('hour', created_at, 'UTC'),
+			(array_agg(price order by created_at))[1], min(created_at), max(price), min(price),
+			(array_agg(price order by created_at desc))[1], max(created_at), count(*)
+		from batch group by 1, 2
+		on conflict (currency_name, bucket) do update set ` + rollupMerge + `
+	), daily as (
+		insert into currency_history_daily as b
+			(currency_name, bucket, open, open_at, high, low, close, close_at, samples)
+		select currency_name, date_trunc('day', created_at, 'UTC'),
+			(array_agg(price order by created_at))[1], min(created_at), max(price), min(price),
+			(array_agg(price order by created_at desc))[1], max(created_at), count(*)
+		from batch group by 1, 2
+		on conflict (currency_name, bucket) do update set ` + rollupMerge + `
+	)
+	select count(*) from batch`
+
+const rollupMerge = `
+		open = case when excluded.open_at < b.open_at then excluded.open else b.open end,
+		open_at = least(b.open_at, excluded.open_at),
+		high = greatest(b.high, excluded.high),
+		low = least(b.low, excluded.low),
+		close = case when excluded.close_at >= b.close_at then excluded.close else b.close end,
+		close_at = greatest(b.close_at, excluded.close_at),
+		samples = b.samples + excluded.samples`
+
+// RollupHistory merges up to limit raw ticks into the hourly and daily
+// aggregates and returns how many it merged. Each tick is merged once.
+func (r Repository) RollupHistory(ctx context.Context, limit int) (int64, error) {
+	defer observeQuery("RollupHistory")()
+
+	var rolled int64
+
+	if err := r.conn.QueryRow(ctx, rollupQuery, limit).Scan(&rolled); err != nil {
+		return 0, fmt.Errorf("error in Repository's method RollupHistory: %w", err)
+	}
+
+	return rolled, nil
+}
+
+// DeleteHistory deletes up to limit raw ticks quoted before the given time that
+// are already rolled up, and returns how many it deleted.
+func (r Repository) DeleteHistory(ctx context.Context, before time.Time, limit int) (int64, error) {
+	defer observeQuery("DeleteHistory")()
+
+	query := `delete from currency_history where id in (
+				select id from currency_history where rolled_up and created_at < $1 order by id limit $2)`
+
+	tag, err := r.conn.Exec(ctx, query, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error in Repository's method DeleteHistory: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// DeleteRollups deletes up to limit aggregates of the granularity, hourly or
+// daily, whose bucket starts before the given time, and returns how many it deleted.
+func (r Repository) DeleteRollups(ctx context.Context, granularity string, before time.Time, limit int) (int64, error) {
+	defer observeQuery("DeleteRollups")()
+
+	table, ok := rollupTables[granularity]
+	if !ok {
+		return 0, fmt.Errorf("error in Repository's method DeleteRollups: %w: %q", errGranularity, granularity)
+	}
+
+	query := `delete from ` + table + ` where (currency_name, bucket) in (
+				select currency_name, bucket from ` + table + ` where bucket < $1 order by bucket limit $2)`
+
+	tag, err := r.conn.Exec(ctx, query, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error in Repository's method DeleteRollups: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// SelectChatTimezone returns the timezone set for a Telegram chat, or an empty string if none is set.
+func (r Repository) SelectChatTimezone(ctx context.Context, chatID int64) (string, error) {
+	defer observeQuery("SelectChatTimezone")()
+
+	var timezone string
+
+	err := r.conn.QueryRow(ctx, "select timezone from bot_chat where chat_id = $1", chatID).Scan(&timezone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error in Repository's method SelectChatTimezone: %w", err)
+	}
+
+	return timezone, nil
+}
+
+func (r Repository) SetChatTimezone(ctx context.Context, chatID int64, timezone string) error {
+	defer observeQuery("SetChatTimezone")()
+
+	query := `insert into bot_chat (chat_id, timezone) values ($1, $2)
+				on conflict (chat_id) do update set timezone = excluded.timezone`
+
+	if _, err := r.conn.Exec(ctx, query, chatID, timezone); err != nil {
+		return fmt.Errorf("error in Repository's method SetChatTimezone: %w", err)
+	}
+
+	return nil
+}
+
+// SelectJobRuns returns when each scheduled job last ran, by job tag.
+func (r Repository) SelectJobRuns(ctx context.Context) (map[string]time.Time, error) {
+	defer observeQuery("SelectJobRuns")()
+
+	rows, err := r.conn.Query(ctx, "select job, last_run_at from job_run")
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectJobRuns: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make(map[string]time.Time)
+
+	for rows.Next() {
+		var (
+			job  string
+			last time.Time
+		)
+
+		if err := rows.Scan(&job, &last); err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectJobRuns: %w", err)
+		}
+
+		runs[job] = last
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectJobRuns: %w", err)
+	}
+
+	return runs, nil
+}
+
+// SetJobRun records that the job started a run at ranAt, unless a later run is recorded.
+func (r Repository) SetJobRun(ctx context.Context, job string, ranAt time.Time) error {
+	defer observeQuery("SetJobRun")()
+
+	query := `insert into job_run (job, last_run_at) values ($1, $2)
+				on conflict (job) do update set last_run_at = greatest(job_run.last_run_at, excluded.last_run_at)`
+
+	if _, err := r.conn.Exec(ctx, query, job, ranAt); err != nil {
+		return fmt.Errorf("error in Repository's method SetJobRun: %w", err)
+	}
+
+	return nil
+}
+
+// SelectLatestHistory returns the last limit history records of a currency, oldest first.
+// Records older than the last accepted quarantined quote are left out: accepting
+// it confirms a new price level, against which later prices are judged.
+func (r Repository) SelectLatestHistory(ctx context.Context, name string, limit int) ([]HistoryRecord, error) {
+	defer observeQuery("SelectLatestHistory")()
+
+	var history []HistoryRecord
+
+	query := `select currency_name, price, created_at, ingested_at from (
+				select currency_name, price, created_at, ingested_at from currency_history
+				where currency_name = $1 and created_at >= coalesce((
+					select max(quoted_at) from quarantined_quote where currency_name = $1 and status = 'accepted'
+				), '-infinity')
+				order by created_at desc limit $2
+			) latest order by created_at`
+
+	rows, err := r.conn.Query(ctx, query, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectLatestHistory: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record HistoryRecord
+
+		err := rows.Scan(&record.CurrencyName, &record.CurrencyPrice, &record.CreatedAt, &record.IngestedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectLatestHistory: %w", err)
+		}
+
+		record.CreatedAt = record.CreatedAt.UTC()
+		record.IngestedAt = record.IngestedAt.UTC()
+
+		history = append(history, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectLatestHistory: %w", err)
+	}
+
+	return history, nil
+}
+
+const quarantineColumns = "id, currency_name, price, reference, reason, quoted_at, received_at, status, " +
+	"resolved_at, occurrences"
+
+func scanQuarantinedQuote(row pgx.Row, quote *QuarantinedQuote) error {
+	err := row.Scan(&quote.ID, &quote.CurrencyName, &quote.Price, &quote.Reference, &quote.Reason,
+		&quote.QuotedAt, &quote.ReceivedAt, &quote.Status, &quote.ResolvedAt, &quote.Occurrences)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	quote.QuotedAt = quote.QuotedAt.UTC()
+	quote.ReceivedAt = quote.ReceivedAt.UTC()
+
+	if quote.ResolvedAt != nil {
+		resolved := quote.ResolvedAt.UTC()
+		quote.ResolvedAt = &resolved
+	}
+
+	return nil
+}
+
+// InsertQuarantine stores a pending quarantined quote and returns it. If the currency
+// already has a pending quote, that one takes the new price. Its occurrences count
+// the suspicious prices in a row within tolerancePercent of the one before, and
+// start over at a price further away; a tolerance of 0 counts every price.
+func (r Repository) InsertQuarantine(
+	ctx context.Context, quote QuarantinedQuote, tolerancePercent float64,
+) (QuarantinedQuote, error) {
+	defer observeQuery("InsertQuarantine")()
+
+	query := `insert into quarantined_quote (currency_name, price, reference, reason, quoted_at, received_at)
+				values ($1, $2, $3, $4, $5, $6)
+				on conflict (currency_name) where status = 'pending' do update set
+					price = excluded.price, reference = excluded.reference, reason = excluded.reason,
+					quoted_at = excluded.quoted_at, received_at = excluded.received_at,
+					occurrences = case
+						when $7::numeric <= 0 or abs(excluded.price - quarantined_quote.price) * 100
+							<= $7::numeric * abs(quarantined_quote.price)
+						then quarantined_quote.occurrences + 1
+						else 1
+					end
+				returning ` + quarantineColumns
+
+	var stored QuarantinedQuote
+
+	row := r.conn.QueryRow(ctx, query, quote.CurrencyName, quote.Price, quote.Reference, quote.Reason,
+		quote.QuotedAt, quote.ReceivedAt, tolerancePercent)
+	if err := scanQuarantinedQuote(row, &stored); err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Repository's method InsertQuarantine: %w", err)
+	}
+
+	return stored, nil
+}
+
+// ClaimQuarantineNotices returns the pending quotes that nobody was told about
+// yet and marks them as notified, so that each is returned once.
+func (r Repository) ClaimQuarantineNotices(ctx context.Context) ([]QuarantinedQuote, error) {
+	defer observeQuery("ClaimQuarantineNotices")()
+
+	var quotes []QuarantinedQuote
+
+	query := `update quarantined_quote set notified_at = now()
+				where status = 'pending' and notified_at is null returning ` + quarantineColumns
+
+	rows, err := r.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method ClaimQuarantineNotices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var quote QuarantinedQuote
+
+		if err := scanQuarantinedQuote(rows, &quote); err != nil {
+			return nil, fmt.Errorf("error in Repository's method ClaimQuarantineNotices: %w", err)
+		}
+
+		quotes = append(quotes, quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method ClaimQuarantineNotices: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// SelectQuarantine returns the quarantined quotes with status, or all if status is empty, newest first.
+func (r Repository) SelectQuarantine(ctx context.Context, status string) ([]QuarantinedQuote, error) {
+	defer observeQuery("SelectQuarantine")()
+
+	quotes := []QuarantinedQuote{}
+
+	query := `select ` + quarantineColumns + ` from quarantined_quote
+				where $1 = '' or status = $1 order by received_at desc, id desc`
+
+	rows, err := r.conn.Query(ctx, query, status)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectQuarantine: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var quote QuarantinedQuote
+
+		if err := scanQuarantinedQuote(rows, &quote); err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectQuarantine: %w", err)
+		}
+
+		quotes = append(quotes, quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectQuarantine: %w", err)
+	}
+
+	return quotes, nil
+}
+
+// SelectQuarantinedQuote returns one quarantined quote, or pgx.ErrNoRows if there is none with id.
+func (r Repository) SelectQuarantinedQuote(ctx context.Context, id int64) (QuarantinedQuote, error) {
+	defer observeQuery("SelectQuarantinedQuote")()
+
+	var quote QuarantinedQuote
+
+	row := r.conn.QueryRow(ctx, `select `+quarantineColumns+` from quarantined_quote where id = $1`, id)
+	if err := scanQuarantinedQuote(row, &quote); err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Repository's method SelectQuarantinedQuote: %w", err)
+	}
+
+	return quote, nil
+}
+
+// ResolveQuarantine sets the status of a pending quote. It returns pgx.ErrNoRows
+// if the quote is not pending, so that it is resolved only once.
+func (r Repository) ResolveQuarantine(ctx context.Context, id int64, status string) (QuarantinedQuote, error) {
+	defer observeQuery("ResolveQuarantine")()
+
+	var quote QuarantinedQuote
+
+	query := `update quarantined_quote set status = $2, resolved_at = now()
+				where id = $1 and status = 'pending' returning ` + quarantineColumns
+
+	if err := scanQuarantinedQuote(r.conn.QueryRow(ctx, query, id, status), &quote); err != nil {
+		return QuarantinedQuote{}, fmt.Errorf("error in Repository's method ResolveQuarantine: %w", err)
+	}
+
+	return quote, nil
+}
+
+// InsertWebhook stores a webhook and returns it with its id and creation time.
+func (r Repository) InsertWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	defer observeQuery("InsertWebhook")()
+
+	query := `insert into webhook (url, secret, events) values ($1, $2, $3) returning id, created_at`
+
+	err := r.conn.QueryRow(ctx, query, webhook.URL, webhook.Secret, webhook.Events).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("error in Repository's method InsertWebhook: %w", err)
+	}
+
+	webhook.CreatedAt = webhook.CreatedAt.UTC()
+
+	return webhook, nil
+}
+
+// SelectWebhooks returns the webhooks without their secrets, oldest first.
+func (r Repository) SelectWebhooks(ctx context.Context) ([]Webhook, error) {
+	defer observeQuery("SelectWebhooks")()
+
+	webhooks := []Webhook{}
+
+	rows, err := r.conn.Query(ctx, "select id, url, events, created_at from webhook order by id")
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectWebhooks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var webhook Webhook
+
+		if err := rows.Scan(&webhook.ID, &webhook.URL, &webhook.Events, &webhook.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectWebhooks: %w", err)
+		}
+
+		webhook.CreatedAt = webhook.CreatedAt.UTC()
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectWebhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes a webhook with its deliveries. It returns pgx.ErrNoRows if there is none with id.
+func (r Repository) DeleteWebhook(ctx context.Context, id int64) error {
+	defer observeQuery("DeleteWebhook")()
+
+	tag, err := r.conn.Exec(ctx, "delete from webhook where id = $1", id)
+	if err != nil {
+		return fmt.Errorf("error in Repository's method DeleteWebhook: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("error in Repository's method DeleteWebhook: %w", pgx.ErrNoRows)
+	}
+
+	return nil
+}
+
+// InsertWebhookDeliveries queues payload for every webhook subscribed to event
+// and returns how many deliveries it queued.
+func (r Repository) InsertWebhookDeliveries(ctx context.Context, event string, payload []byte) (int64, error) {
+	defer observeQuery("InsertWebhookDeliveries")()
+
+	query := `insert into webhook_delivery (webhook_id, event, payload)
+				select id, $1, $2 from webhook where $1 = any(events)`
+
+	tag, err := r.conn.Exec(ctx, query, event, payload)
+	if err != nil {
+		return 0, fmt.Errorf("error in Repository's method InsertWebhookDeliveries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.last_status, d.last_error, d.created_at, d.delivered_at`
+
+func scanWebhookDelivery(row pgx.Row, delivery *WebhookDelivery, extra ...any) error {
+	err := row.Scan(append([]any{&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &delivery.LastStatus, &delivery.LastError,
+		&delivery.CreatedAt, &delivery.DeliveredAt}, extra...)...)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+
+	if delivery.DeliveredAt != nil {
+		delivered := delivery.DeliveredAt.UTC()
+		delivery.DeliveredAt = &delivered
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries returns the oldest pending delivery of up to limit
+// webhooks, with the URL and secret of its webhook, and leases them for lease so
+// that no other worker sends them meanwhile. A webhook whose oldest pending
+// delivery is not due yet, or is leased, is skipped, so that every webhook is
+// sent its deliveries in order and one at a time.
+func (r Repository) ClaimWebhookDeliveries(
+	ctx context.Context, limit int, lease time.Duration,
+) ([]WebhookDelivery, error) {
+	defer observeQuery("ClaimWebhookDeliveries")()
+
+	// for update cannot be combined with distinct on, so the rows are locked in a second step, which checks
+	// them again since another worker may have claimed or sent them after the first step read them.
+	query := `update webhook_delivery d set leased_until = now() + $2::bigint * interval '1 microsecond'
+				from webhook w
+				where w.id = d.webhook_id and d.id in (
+					select id from webhook_delivery where id in (
+						select distinct on (webhook_id) id from webhook_delivery
+						where status = 'pending' order by webhook_id, id)
+					and status = 'pending' and next_attempt_at <= now()
+					and (leased_until is null or leased_until <= now())
+					order by next_attempt_at, id limit $1 for update skip locked)
+				returning ` + webhookDeliveryColumns + `, w.url, w.secret`
+
+	rows, err := r.conn.Query(ctx, query, limit, lease.Microseconds())
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method ClaimWebhookDeliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		if err := scanWebhookDelivery(rows, &delivery, &delivery.URL, &delivery.Secret); err != nil {
+			return nil, fmt.Errorf("error in Repository's method ClaimWebhookDeliveries: %w", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method ClaimWebhookDeliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery stores the outcome of an attempt and ends its lease.
+func (r Repository) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	defer observeQuery("UpdateWebhookDelivery")()
+
+	query := `update webhook_delivery set status = $2, attempts = $3, next_attempt_at = $4, last_status = $5,
+				last_error = $6, delivered_at = $7, leased_until = null where id = $1`
+
+	_, err := r.conn.Exec(ctx, query, delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+		delivery.LastStatus, delivery.LastError, delivery.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("error in Repository's method UpdateWebhookDelivery: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteWebhookDeliveries deletes up to limit delivered or failed deliveries
+// created before the given time, and returns how many it deleted.
+func (r Repository) DeleteWebhookDeliveries(ctx context.Context, before time.Time, limit int) (int64, error) {
+	defer observeQuery("DeleteWebhookDeliveries")()
+
+	query := `delete from webhook_delivery where id in (
+				select id from webhook_delivery where status <> 'pending' and created_at < $1 order by id limit $2)`
+
+	tag, err := r.conn.Exec(ctx, query, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error in Repository's method DeleteWebhookDeliveries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// SelectWebhookDeliveries returns up to limit deliveries of a webhook with
+// status, or with any status if it is empty, newest first.
+func (r Repository) SelectWebhookDeliveries(
+	ctx context.Context, webhookID int64, status string, limit int,
+) ([]WebhookDelivery, error) {
+	defer observeQuery("SelectWebhookDeliveries")()
+
+	deliveries := []WebhookDelivery{}
+
+	query := `select ` + webhookDeliveryColumns + ` from webhook_delivery d
+				where d.webhook_id = $1 and ($2 = '' or d.status = $2) order by d.id desc limit $3`
+
+	rows, err := r.conn.Query(ctx, query, webhookID, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectWebhookDeliveries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, fmt.Errorf("error in Repository's method SelectWebhookDeliveries: %w", err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error in Repository's method SelectWebhookDeliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func (r Repository) Ping(ctx context.Context) error {
+	defer observeQuery("Ping")()
+
+	if err := r.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("error in Repository's method Ping: %w", err)
+	}
+
+	return nil
+}
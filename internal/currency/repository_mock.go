@@ -3,7 +3,9 @@ package currency
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -29,10 +31,10 @@ func (m *MockRepo) InsertCurrencies(ctx context.Context, currencies []Currency)
 	return args.Get(0).([]Currency), args.Error(1)
 }
 
-func (m *MockRepo) SelectChangesPerHour(ctx context.Context, name string) (float64, error) {
+func (m *MockRepo) SelectChangesPerHour(ctx context.Context, name string) (decimal.Decimal, error) {
 	args := m.Called(ctx, name)
 
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).(decimal.Decimal), args.Error(1)
 }
 
 func (m *MockRepo) SetChangesPerHour(ctx context.Context, currencies []Currency) error {
@@ -44,3 +46,180 @@ func (m *MockRepo) SetChangesPerHour(ctx context.Context, currencies []Currency)
 
 	return nil
 }
+
+func (m *MockRepo) SelectHistory(
+	ctx context.Context, name string, from, to time.Time, tiers HistoryTiers,
+) ([]HistoryRecord, error) {
+	args := m.Called(ctx, name, from, to, tiers)
+
+	return args.Get(0).([]HistoryRecord), args.Error(1)
+}
+
+// InTx calls fn with the mock itself; tests see the calls made in the transaction.
+func (m *MockRepo) InTx(_ context.Context, fn func(RepositoryInterface) error) error {
+	return fn(m)
+}
+
+func (m *MockRepo) SelectLatestHistory(ctx context.Context, name string, limit int) ([]HistoryRecord, error) {
+	args := m.Called(ctx, name, limit)
+
+	return args.Get(0).([]HistoryRecord), args.Error(1)
+}
+
+func (m *MockRepo) InsertQuarantine(
+	ctx context.Context, quote QuarantinedQuote, tolerancePercent float64,
+) (QuarantinedQuote, error) {
+	args := m.Called(ctx, quote, tolerancePercent)
+
+	return args.Get(0).(QuarantinedQuote), args.Error(1)
+}
+
+func (m *MockRepo) ClaimQuarantineNotices(ctx context.Context) ([]QuarantinedQuote, error) {
+	args := m.Called(ctx)
+
+	return args.Get(0).([]QuarantinedQuote), args.Error(1)
+}
+
+func (m *MockRepo) SelectQuarantine(ctx context.Context, status string) ([]QuarantinedQuote, error) {
+	args := m.Called(ctx, status)
+
+	return args.Get(0).([]QuarantinedQuote), args.Error(1)
+}
+
+func (m *MockRepo) SelectQuarantinedQuote(ctx context.Context, id int64) (QuarantinedQuote, error) {
+	args := m.Called(ctx, id)
+
+	return args.Get(0).(QuarantinedQuote), args.Error(1)
+}
+
+func (m *MockRepo) ResolveQuarantine(ctx context.Context, id int64, status string) (QuarantinedQuote, error) {
+	args := m.Called(ctx, id, status)
+
+	return args.Get(0).(QuarantinedQuote), args.Error(1)
+}
+
+func (m *MockRepo) RollupHistory(ctx context.Context, limit int) (int64, error) {
+	args := m.Called(ctx, limit)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) DeleteHistory(ctx context.Context, before time.Time, limit int) (int64, error) {
+	args := m.Called(ctx, before, limit)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) DeleteRollups(ctx context.Context, granularity string, before time.Time, limit int) (int64, error) {
+	args := m.Called(ctx, granularity, before, limit)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) InsertWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	args := m.Called(ctx, webhook)
+
+	return args.Get(0).(Webhook), args.Error(1)
+}
+
+func (m *MockRepo) SelectWebhooks(ctx context.Context) ([]Webhook, error) {
+	args := m.Called(ctx)
+
+	return args.Get(0).([]Webhook), args.Error(1)
+}
+
+func (m *MockRepo) DeleteWebhook(ctx context.Context, id int64) error {
+	args := m.Called(ctx, id)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) InsertWebhookDeliveries(ctx context.Context, event string, payload []byte) (int64, error) {
+	args := m.Called(ctx, event, payload)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) ClaimWebhookDeliveries(
+	ctx context.Context, limit int, lease time.Duration,
+) ([]WebhookDelivery, error) {
+	args := m.Called(ctx, limit, lease)
+
+	return args.Get(0).([]WebhookDelivery), args.Error(1)
+}
+
+func (m *MockRepo) UpdateWebhookDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteWebhookDeliveries(ctx context.Context, before time.Time, limit int) (int64, error) {
+	args := m.Called(ctx, before, limit)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) SelectWebhookDeliveries(
+	ctx context.Context, webhookID int64, status string, limit int,
+) ([]WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, status, limit)
+
+	return args.Get(0).([]WebhookDelivery), args.Error(1)
+}
+
+func (m *MockRepo) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) InsertHistory(ctx context.Context, records []HistoryRecord, rawBefore time.Time) (int64, error) {
+	args := m.Called(ctx, records, rawBefore)
+
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) RecomputeExtremes(ctx context.Context, names []string) error {
+	args := m.Called(ctx, names)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) SelectChatTimezone(ctx context.Context, chatID int64) (string, error) {
+	args := m.Called(ctx, chatID)
+
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockRepo) SetChatTimezone(ctx context.Context, chatID int64, timezone string) error {
+	args := m.Called(ctx, chatID, timezone)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) SelectJobRuns(ctx context.Context) (map[string]time.Time, error) {
+	args := m.Called(ctx)
+
+	return args.Get(0).(map[string]time.Time), args.Error(1)
+}
+
+func (m *MockRepo) SetJobRun(ctx context.Context, job string, ranAt time.Time) error {
+	args := m.Called(ctx, job, ranAt)
+
+	return args.Error(0)
+}
+
+func (m *MockRepo) SelectExtremes(ctx context.Context, name string, windows []ExtremeWindow) ([]WindowExtremes, error) {
+	args := m.Called(ctx, name, windows)
+
+	return args.Get(0).([]WindowExtremes), args.Error(1)
+}
+
+func (m *MockRepo) SelectCandles(
+	ctx context.Context, name string, interval time.Duration, from, to time.Time, tiers HistoryTiers,
+) ([]Candle, error) {
+	args := m.Called(ctx, name, interval, from, to, tiers)
+
+	return args.Get(0).([]Candle), args.Error(1)
+}
@@ -1,5 +1,124 @@
 package currency
 
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/internal/migrate"
+	"github.com/crackc0der/currency/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // func TestRepositorySelectAllCurrencies(t *testing.T) {
 
 // }
+
+// newTestRepository migrates the database of CURRENCY_TEST_DSN and connects to
+// it, or skips the test if the variable is not set. The tests using it clear
+// the tables they use, so the database must be one for tests only.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+
+	dsn := os.Getenv("CURRENCY_TEST_DSN")
+	if dsn == "" {
+		t.Skip("CURRENCY_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+
+	loaded, err := migrate.Load(migrations.FS)
+	require.NoError(t, err)
+
+	conn, err := pgx.Connect(ctx, dsn)
+	require.NoError(t, err)
+
+	defer func() { _ = conn.Close(ctx) }()
+
+	_, err = migrate.NewMigrator(conn, loaded).Up(ctx)
+	require.NoError(t, err)
+
+	repo, err := NewRepository(dsn)
+	require.NoError(t, err)
+	t.Cleanup(repo.Close)
+
+	return repo
+}
+
+func TestRepositoryClaimWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+
+	repo := newTestRepository(t)
+	ctx := context.Background()
+
+	_, err := repo.pool.Exec(ctx, "truncate webhook, webhook_delivery")
+	require.NoError(t, err)
+
+	first, err := repo.InsertWebhook(ctx, Webhook{URL: "https://example.com/a", Events: []string{EventRateUpdated}})
+	require.NoError(t, err)
+	second, err := repo.InsertWebhook(ctx, Webhook{URL: "https://example.com/b", Events: []string{EventRateUpdated}})
+	require.NoError(t, err)
+
+	for range 2 {
+		queued, err := repo.InsertWebhookDeliveries(ctx, EventRateUpdated, []byte(`{}`))
+		require.NoError(t, err)
+		require.Equal(t, int64(2), queued)
+	}
+
+	claimIDs := func() map[int64]int64 {
+		deliveries, err := repo.ClaimWebhookDeliveries(ctx, webhookBatchSize, time.Minute)
+		require.NoError(t, err)
+
+		ids := map[int64]int64{}
+		for _, delivery := range deliveries {
+			ids[delivery.WebhookID] = delivery.ID
+		}
+
+		return ids
+	}
+
+	deliveries, err := repo.ClaimWebhookDeliveries(ctx, webhookBatchSize, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+
+	claimed := map[int64]WebhookDelivery{}
+	for _, delivery := range deliveries {
+		claimed[delivery.WebhookID] = delivery
+	}
+
+	oldest, err := repo.SelectWebhookDeliveries(ctx, first.ID, DeliveryPending, webhookDeliveryLimit)
+	require.NoError(t, err)
+	assert.Equal(t, oldest[len(oldest)-1].ID, claimed[first.ID].ID, "the oldest delivery goes first")
+	assert.Equal(t, "https://example.com/b", claimed[second.ID].URL)
+
+	// Leased deliveries hold up the later ones of their webhooks.
+	assert.Empty(t, claimIDs())
+
+	// So does a delivery waiting to be retried, even though the later ones are due.
+	retried := claimed[first.ID]
+	retried.Attempts = 1
+	retried.NextAttemptAt = time.Now().Add(time.Hour)
+	require.NoError(t, repo.UpdateWebhookDelivery(ctx, retried))
+
+	delivered := claimed[second.ID]
+	delivered.Status = DeliveryDelivered
+	delivered.Attempts = 1
+	require.NoError(t, repo.UpdateWebhookDelivery(ctx, delivered))
+
+	next := claimIDs()
+	assert.Len(t, next, 1)
+	assert.Greater(t, next[second.ID], delivered.ID)
+
+	// An expired lease, of a worker that died, lets the delivery be claimed again.
+	retried.NextAttemptAt = time.Now()
+	require.NoError(t, repo.UpdateWebhookDelivery(ctx, retried))
+
+	deliveries, err = repo.ClaimWebhookDeliveries(ctx, webhookBatchSize, time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, map[int64]int64{first.ID: retried.ID}, claimIDs())
+}
@@ -0,0 +1,176 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	GranularityHourly = "hourly"
+	GranularityDaily  = "daily"
+
+	day = 24 * time.Hour
+)
+
+var errGranularity = errors.New("unknown history granularity")
+
+// rollupTables maps a granularity to the table of its aggregates.
+//
+//nolint:gochecknoglobals
+var rollupTables = map[string]string{
+	GranularityHourly: "currency_history_hourly",
+	GranularityDaily:  "currency_history_daily",
+}
+
+// HistoryTiers tells at which granularity history is complete: raw ticks from
+// Raw on, hourly aggregates from Hourly on and daily aggregates before, since
+// the retention job may have deleted older raw ticks and hourly aggregates.
+// A zero time means nothing was deleted. Hourly is never after Raw, since raw
+// ticks cover the time they are kept for.
+type HistoryTiers struct {
+	Raw    time.Time
+	Hourly time.Time
+}
+
+// historyTiers returns the tiers as of now. Runs of the retention job before
+// now deleted only what is older than these.
+func (s Service) historyTiers(now time.Time) HistoryTiers {
+	var tiers HistoryTiers
+
+	conf := s.Config()
+	if conf == nil {
+		return tiers
+	}
+
+	if conf.Retention.RawDays > 0 {
+		tiers.Raw = now.Add(-time.Duration(conf.Retention.RawDays) * day).UTC()
+	}
+
+	if conf.Retention.HourlyDays > 0 && !tiers.Raw.IsZero() {
+		tiers.Hourly = now.Add(-time.Duration(conf.Retention.HourlyDays) * day).UTC()
+		if tiers.Hourly.After(tiers.Raw) {
+			tiers.Hourly = tiers.Raw
+		}
+	}
+
+	return tiers
+}
+
+// RetentionResult counts the rows one run of the retention job touched.
+type RetentionResult struct {
+	RolledUp      int64
+	DeletedRaw    int64
+	DeletedHourly int64
+	DeletedDaily  int64
+	// DeletedDeliveries counts delivered and failed webhook deliveries.
+	DeletedDeliveries int64
+}
+
+// MaintainHistory rolls new raw ticks up into the hourly and daily aggregates
+// and deletes what is older than the configured retention, as well as old
+// webhook deliveries.
+func (s Service) MaintainHistory() {
+	result, err := s.maintainHistory(context.Background(), time.Now())
+	if err != nil {
+		s.log.Error("could not maintain history", slog.Any("error", err))
+
+		return
+	}
+
+	s.log.Info("history maintained", slog.Int64("rolledUp", result.RolledUp), slog.Int64("deletedRaw", result.DeletedRaw),
+		slog.Int64("deletedHourly", result.DeletedHourly), slog.Int64("deletedDaily", result.DeletedDaily),
+		slog.Int64("deletedDeliveries", result.DeletedDeliveries))
+}
+
+// maintainHistory rolls up before it deletes, and raw ticks are only deleted
+// once rolled up, so a failed run loses nothing. Every statement handles at
+// most retention.batchSize rows so that no lock is held for long.
+func (s Service) maintainHistory(ctx context.Context, now time.Time) (RetentionResult, error) {
+	var result RetentionResult
+
+	retention := s.Config().Retention
+
+	err := inBatches(ctx, &result.RolledUp, retention.BatchSize, func(ctx context.Context) (int64, error) {
+		return s.repository.RollupHistory(ctx, retention.BatchSize)
+	})
+	if err != nil {
+		return result, fmt.Errorf("error in Service's method maintainHistory: %w", err)
+	}
+
+	observeRetention("rolled_up", result.RolledUp)
+
+	if retention.RawDays > 0 {
+		before := now.Add(-time.Duration(retention.RawDays) * day)
+
+		err := inBatches(ctx, &result.DeletedRaw, retention.BatchSize, func(ctx context.Context) (int64, error) {
+			return s.repository.DeleteHistory(ctx, before, retention.BatchSize)
+		})
+		if err != nil {
+			return result, fmt.Errorf("error in Service's method maintainHistory: %w", err)
+		}
+
+		observeRetention("deleted_raw", result.DeletedRaw)
+	}
+
+	for _, rollup := range []struct {
+		granularity string
+		days        int
+		deleted     *int64
+	}{
+		{GranularityHourly, retention.HourlyDays, &result.DeletedHourly},
+		{GranularityDaily, retention.DailyDays, &result.DeletedDaily},
+	} {
+		if rollup.days <= 0 {
+			continue
+		}
+
+		before := now.Add(-time.Duration(rollup.days) * day)
+
+		err := inBatches(ctx, rollup.deleted, retention.BatchSize, func(ctx context.Context) (int64, error) {
+			return s.repository.DeleteRollups(ctx, rollup.granularity, before, retention.BatchSize)
+		})
+		if err != nil {
+			return result, fmt.Errorf("error in Service's method maintainHistory: %w", err)
+		}
+
+		observeRetention("deleted_"+rollup.granularity, *rollup.deleted)
+	}
+
+	if days := s.Config().Webhooks.RetentionDays; days > 0 {
+		before := now.Add(-time.Duration(days) * day)
+
+		err := inBatches(ctx, &result.DeletedDeliveries, retention.BatchSize, func(ctx context.Context) (int64, error) {
+			return s.repository.DeleteWebhookDeliveries(ctx, before, retention.BatchSize)
+		})
+		if err != nil {
+			return result, fmt.Errorf("error in Service's method maintainHistory: %w", err)
+		}
+
+		observeRetention("deleted_deliveries", result.DeletedDeliveries)
+	}
+
+	return result, nil
+}
+
+// inBatches calls batch until it handles fewer than size rows, adding them up in total.
+func inBatches(ctx context.Context, total *int64, size int, batch func(context.Context) (int64, error)) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		rows, err := batch(ctx)
+		*total += rows
+
+		if err != nil {
+			return err
+		}
+
+		if rows < int64(size) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errRollup = errors.New("rollup failed")
+
+func TestMaintainHistory(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := new(MockRepo)
+	repo.On("RollupHistory", mock.Anything, 2).Return(int64(2), nil).Twice()
+	repo.On("RollupHistory", mock.Anything, 2).Return(int64(1), nil).Once()
+	repo.On("DeleteHistory", mock.Anything, now.AddDate(0, 0, -30), 2).Return(int64(2), nil).Once()
+	repo.On("DeleteHistory", mock.Anything, now.AddDate(0, 0, -30), 2).Return(int64(0), nil).Once()
+	repo.On("DeleteRollups", mock.Anything, GranularityHourly, now.AddDate(0, 0, -365), 2).Return(int64(1), nil).Once()
+	repo.On("DeleteWebhookDeliveries", mock.Anything, now.AddDate(0, 0, -30), 2).Return(int64(1), nil).Once()
+
+	conf := config.Default()
+	conf.Retention = config.Retention{RawDays: 30, HourlyDays: 365, BatchSize: 2}
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	result, err := svc.maintainHistory(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, RetentionResult{RolledUp: 5, DeletedRaw: 2, DeletedHourly: 1, DeletedDeliveries: 1}, result)
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "DeleteRollups", mock.Anything, GranularityDaily, mock.Anything, mock.Anything)
+}
+
+func TestMaintainHistoryKeepsRawTicksIfRollupFails(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("RollupHistory", mock.Anything, mock.Anything).Return(int64(0), errRollup)
+
+	conf := config.Default()
+	conf.Retention.RawDays = 1
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	_, err := svc.maintainHistory(context.Background(), time.Now())
+	require.ErrorIs(t, err, errRollup)
+	repo.AssertNotCalled(t, "DeleteHistory", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestHistoryTiers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	conf := config.Default()
+	conf.Retention = config.Retention{RawDays: 30, HourlyDays: 365, BatchSize: 2}
+	svc := NewService(new(MockRepo), slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	assert.Equal(t, HistoryTiers{Raw: now.AddDate(0, 0, -30), Hourly: now.AddDate(0, 0, -365)}, svc.historyTiers(now))
+
+	// Raw ticks kept longer than hourly aggregates, or forever, cover the time of the deleted aggregates.
+	shorterHourly := config.Default()
+	shorterHourly.Retention = config.Retention{RawDays: 30, HourlyDays: 7, BatchSize: 2}
+	require.NoError(t, svc.Reload(&shorterHourly))
+	assert.Equal(t, HistoryTiers{Raw: now.AddDate(0, 0, -30), Hourly: now.AddDate(0, 0, -30)}, svc.historyTiers(now))
+
+	rawForever := config.Default()
+	rawForever.Retention = config.Retention{HourlyDays: 7, BatchSize: 2}
+	require.NoError(t, svc.Reload(&rawForever))
+	assert.Equal(t, HistoryTiers{}, svc.historyTiers(now))
+
+	// Without a retention nothing was deleted, and without a config neither.
+	unlimited := config.Default()
+	require.NoError(t, svc.Reload(&unlimited))
+	assert.Equal(t, HistoryTiers{}, svc.historyTiers(now))
+	assert.Equal(t, HistoryTiers{}, NewService(new(MockRepo), svc.log, nil).historyTiers(now))
+}
@@ -0,0 +1,269 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/go-co-op/gocron"
+)
+
+const (
+	tagCurrencyMonitor = "currency-monitor"
+	tagChangesPerHour  = "changes-per-hour"
+	tagRetention       = "retention"
+
+	catchUpCheckTimeout = 5 * time.Second
+	jobRunTimeout       = 5 * time.Second
+)
+
+// Scheduler runs the periodic Service jobs and lets their schedules change
+// while the process is running.
+type Scheduler struct {
+	scheduler *gocron.Scheduler
+	service   *Service
+	log       *slog.Logger
+	mu        sync.Mutex
+	schedules map[string]scheduledJob
+	jitter    atomic.Int64
+	runOnce   atomic.Bool
+	runMu     sync.Mutex
+	done      chan struct{}
+}
+
+func NewScheduler(scheduler *gocron.Scheduler, service *Service, log *slog.Logger) *Scheduler {
+	return &Scheduler{
+		scheduler: scheduler,
+		service:   service,
+		log:       log,
+		schedules: make(map[string]scheduledJob),
+	}
+}
+
+type scheduledJob struct {
+	tag      string
+	schedule config.Schedule
+	job      func()
+}
+
+// Schedule adds the jobs with the schedules from conf, replacing jobs whose
+// schedule changed. Jobs first run at their next scheduled time; the missedRuns
+// policy decides whether Start also runs overdue jobs right away. The schedules
+// are checked first, so an error leaves the current ones in effect.
+func (s *Scheduler) Schedule(conf *config.Config) error {
+	if err := s.Check(conf); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jitter.Store(int64(conf.Jitter()))
+	s.runOnce.Store(conf.Schedules.MissedRuns == config.MissedRunsRunOnce)
+
+	for _, job := range s.jobs(conf) {
+		current, scheduled := s.schedules[job.tag]
+		if scheduled && current.schedule.String() == job.schedule.String() {
+			continue
+		}
+
+		if scheduled {
+			if err := s.scheduler.RemoveByTag(job.tag); err != nil {
+				return fmt.Errorf("error in Scheduler's method Schedule: %s: %w", job.tag, err)
+			}
+		}
+
+		if err := s.add(s.scheduler, job); err != nil {
+			return err
+		}
+
+		s.schedules[job.tag] = job
+		s.log.Info("job scheduled", slog.String("job", job.tag), slog.String("schedule", job.schedule.String()))
+	}
+
+	return nil
+}
+
+// Check reports whether the schedules in conf can be scheduled, without
+// changing the running jobs.
+func (s *Scheduler) Check(conf *config.Config) error {
+	scratch := gocron.NewScheduler(time.UTC)
+
+	for _, job := range s.jobs(conf) {
+		if err := s.add(scratch, job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Scheduler) jobs(conf *config.Config) []scheduledJob {
+	return []scheduledJob{
+		{tag: tagCurrencyMonitor, schedule: conf.MonitorSchedule(), job: s.service.CurrencyMonitor},
+		{tag: tagChangesPerHour, schedule: conf.ChangesPerHourSchedule(), job: s.service.SetChangesPerHour},
+		{tag: tagRetention, schedule: conf.RetentionSchedule(), job: s.service.MaintainHistory},
+	}
+}
+
+func (s *Scheduler) add(scheduler *gocron.Scheduler, job scheduledJob) error {
+	var builder *gocron.Scheduler
+
+	switch {
+	case job.schedule.Every > 0:
+		builder = scheduler.Every(job.schedule.Every).StartAt(job.schedule.Next(time.Now()))
+	case job.schedule.WithSeconds():
+		builder = scheduler.CronWithSeconds(job.schedule.Cron)
+	default:
+		builder = scheduler.Cron(job.schedule.Cron)
+	}
+
+	_, err := builder.SingletonMode().Tag(job.tag).Do(s.withJitter(s.recordRun(job.tag, job.job)))
+	if err != nil {
+		return fmt.Errorf("error in Scheduler's method add: %s: %w", job.tag, err)
+	}
+
+	return nil
+}
+
+// recordRun stores when each run of job started once it finished, so that a
+// replica taking over knows whether a run was missed.
+func (s *Scheduler) recordRun(tag string, job func()) func() {
+	return func() {
+		started := time.Now()
+
+		job()
+
+		ctx, cancel := context.WithTimeout(context.Background(), jobRunTimeout)
+		defer cancel()
+
+		if err := s.service.repository.SetJobRun(ctx, tag, started); err != nil {
+			s.log.Warn("could not record job run", slog.String("job", tag), slog.Any("error", err))
+		}
+	}
+}
+
+// catchUp runs every job whose last run, on any replica, is older than its
+// period, i.e. a run was missed while no replica was leading. A job that never
+// ran, or whose runs cannot be checked, runs too. The runs go through the
+// scheduled jobs, so they are jittered and do not overlap a scheduled run.
+func (s *Scheduler) catchUp() {
+	ctx, cancel := context.WithTimeout(context.Background(), catchUpCheckTimeout)
+	defer cancel()
+
+	runs, err := s.service.repository.SelectJobRuns(ctx)
+	if err != nil {
+		s.log.Warn("could not check for missed runs", slog.Any("error", err))
+	}
+
+	s.mu.Lock()
+	overdue := overdueJobs(s.schedules, runs, time.Now())
+	s.mu.Unlock()
+
+	for _, tag := range overdue {
+		if err := s.scheduler.RunByTag(tag); err != nil {
+			s.log.Warn("could not run missed job", slog.String("job", tag), slog.Any("error", err))
+
+			continue
+		}
+
+		s.log.Info("running missed job", slog.String("job", tag), slog.Time("lastRun", runs[tag]))
+	}
+}
+
+// overdueJobs returns the tags, in order, of the jobs that have not run within
+// their period before now.
+func overdueJobs(jobs map[string]scheduledJob, runs map[string]time.Time, now time.Time) []string {
+	var overdue []string
+
+	for tag, job := range jobs {
+		if last, ok := runs[tag]; ok && now.Sub(last) < job.schedule.Period(now) {
+			continue
+		}
+
+		overdue = append(overdue, tag)
+	}
+
+	slices.Sort(overdue)
+
+	return overdue
+}
+
+// withJitter delays every run of job by a random duration below the configured
+// jitter. The delay is cut short by Stop.
+func (s *Scheduler) withJitter(job func()) func() {
+	return func() {
+		if jitter := time.Duration(s.jitter.Load()); jitter > 0 {
+			select {
+			case <-time.After(rand.N(jitter)):
+			case <-s.stopping():
+				return
+			}
+		}
+
+		job()
+	}
+}
+
+// Start runs the scheduler in the background and, under the runOnce policy,
+// catches up on missed runs. It may be started again after Stop, which happens
+// when a replica regains leadership. The jobs are added anew, since gocron runs
+// interval jobs right away when it is started again.
+func (s *Scheduler) Start() {
+	s.runMu.Lock()
+	if s.done == nil {
+		s.done = make(chan struct{})
+	}
+	s.runMu.Unlock()
+
+	if err := s.reset(); err != nil {
+		s.log.Error("could not schedule jobs", slog.Any("error", err))
+	}
+
+	s.scheduler.StartAsync()
+
+	if s.runOnce.Load() {
+		s.catchUp()
+	}
+}
+
+func (s *Scheduler) reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scheduler.Clear()
+
+	for _, job := range s.schedules {
+		if err := s.add(s.scheduler, job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stop stops the scheduler and waits for running jobs to finish.
+func (s *Scheduler) Stop() {
+	s.runMu.Lock()
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	s.runMu.Unlock()
+
+	s.scheduler.Stop()
+}
+
+// stopping returns a channel closed by Stop, or nil while the scheduler is not running.
+func (s *Scheduler) stopping() <-chan struct{} {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	return s.done
+}
@@ -0,0 +1,137 @@
+package currency
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/go-co-op/gocron"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerCheckDoesNotSchedule(t *testing.T) {
+	t.Parallel()
+
+	conf := config.Default()
+	conf.Schedules.Monitor = "*/5 * * * *"
+	conf.Schedules.MissedRuns = config.MissedRunsSkip
+
+	cron := gocron.NewScheduler(time.UTC)
+	scheduler := NewScheduler(cron, NewService(new(MockRepo), slog.New(slog.NewTextHandler(os.Stdout, nil)), nil),
+		slog.New(slog.NewTextHandler(os.Stdout, nil)))
+
+	require.NoError(t, scheduler.Check(&conf))
+	assert.Zero(t, cron.Len())
+
+	require.NoError(t, scheduler.Schedule(&conf))
+	assert.Equal(t, 3, cron.Len())
+}
+
+func TestOverdueJobs(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	jobs := map[string]scheduledJob{
+		tagCurrencyMonitor: {schedule: config.Schedule{Every: time.Hour}},
+		tagRetention:       {schedule: config.Schedule{Every: 24 * time.Hour}},
+	}
+
+	tests := []struct {
+		name string
+		runs map[string]time.Time
+		want []string
+	}{
+		{
+			name: "never ran",
+			want: []string{tagCurrencyMonitor, tagRetention},
+		},
+		{
+			name: "within their periods",
+			runs: map[string]time.Time{
+				tagCurrencyMonitor: now.Add(-30 * time.Minute),
+				tagRetention:       now.Add(-23 * time.Hour),
+			},
+		},
+		{
+			name: "each job by its own period",
+			runs: map[string]time.Time{
+				tagCurrencyMonitor: now.Add(-2 * time.Hour),
+				tagRetention:       now.Add(-2 * time.Hour),
+			},
+			want: []string{tagCurrencyMonitor},
+		},
+		{
+			name: "one job never ran",
+			runs: map[string]time.Time{tagCurrencyMonitor: now.Add(-time.Minute)},
+			want: []string{tagRetention},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, testCase.want, overdueJobs(jobs, testCase.runs, now))
+		})
+	}
+}
+
+func TestSchedulerCatchesUpWhenStarted(t *testing.T) {
+	t.Parallel()
+
+	conf := config.Default()
+
+	repo := new(MockRepo)
+	repo.On("SelectJobRuns", mock.Anything).Return(map[string]time.Time{
+		tagCurrencyMonitor: time.Now().Add(-time.Minute),
+		tagChangesPerHour:  time.Now().Add(-time.Minute),
+		tagRetention:       time.Now().Add(-2 * time.Hour),
+	}, nil)
+	repo.On("RollupHistory", mock.Anything, mock.Anything).Return(int64(0), errRollup)
+	recorded := make(chan struct{}, 1)
+	repo.On("SetJobRun", mock.Anything, tagRetention, mock.Anything).Return(nil).Run(func(mock.Arguments) {
+		recorded <- struct{}{}
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	scheduler := NewScheduler(gocron.NewScheduler(time.UTC), NewService(repo, logger, &conf), logger)
+	require.NoError(t, scheduler.Schedule(&conf))
+
+	// Every start, such as on regaining leadership, checks for missed runs again.
+	for range 2 {
+		scheduler.Start()
+
+		select {
+		case <-recorded:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the overdue job did not run")
+		}
+
+		scheduler.Stop()
+	}
+
+	repo.AssertNumberOfCalls(t, "SelectJobRuns", 2)
+	repo.AssertNumberOfCalls(t, "RollupHistory", 2)
+}
+
+func TestSchedulerSkipsMissedRuns(t *testing.T) {
+	t.Parallel()
+
+	conf := config.Default()
+	conf.Schedules.MissedRuns = config.MissedRunsSkip
+
+	repo := new(MockRepo)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	scheduler := NewScheduler(gocron.NewScheduler(time.UTC), NewService(repo, logger, &conf), logger)
+	require.NoError(t, scheduler.Schedule(&conf))
+
+	scheduler.Start()
+	scheduler.Stop()
+
+	repo.AssertNotCalled(t, "SelectJobRuns", mock.Anything)
+}
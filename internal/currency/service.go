@@ -2,37 +2,192 @@ package currency
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net"
-	"net/http"
-	"strconv"
+	"slices"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/crackc0der/currency/config"
+	"github.com/shopspring/decimal"
+)
+
+const defaultHistoryWindow = 24 * time.Hour
+
+// extremeWindows are the windows GetCurrency reports min/max prices for. A zero length means all time.
+//
+//nolint:gochecknoglobals
+var extremeWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"all", 0},
+}
+
+var (
+	errNoProvider = errors.New("no rate provider configured")
+	errTimezone   = errors.New("unknown time zone")
 )
 
 type RepositoryInterface interface {
 	SelectAllCurrencies(context.Context) ([]Currency, error)
 	SelectCurrency(context.Context, string) (*Currency, error)
 	InsertCurrencies(context.Context, []Currency) ([]Currency, error)
-	SelectChangesPerHour(context.Context, string) (float64, error)
+	SelectChangesPerHour(context.Context, string) (decimal.Decimal, error)
 	SetChangesPerHour(context.Context, []Currency) error
+	SelectHistory(context.Context, string, time.Time, time.Time, HistoryTiers) ([]HistoryRecord, error)
+	SelectExtremes(context.Context, string, []ExtremeWindow) ([]WindowExtremes, error)
+	SelectCandles(context.Context, string, time.Duration, time.Time, time.Time, HistoryTiers) ([]Candle, error)
+	InsertHistory(context.Context, []HistoryRecord, time.Time) (int64, error)
+	RecomputeExtremes(context.Context, []string) error
+	SelectChatTimezone(context.Context, int64) (string, error)
+	SetChatTimezone(context.Context, int64, string) error
+	SelectJobRuns(context.Context) (map[string]time.Time, error)
+	SetJobRun(context.Context, string, time.Time) error
+	InTx(context.Context, func(RepositoryInterface) error) error
+	SelectLatestHistory(context.Context, string, int) ([]HistoryRecord, error)
+	InsertQuarantine(context.Context, QuarantinedQuote, float64) (QuarantinedQuote, error)
+	ClaimQuarantineNotices(context.Context) ([]QuarantinedQuote, error)
+	SelectQuarantine(context.Context, string) ([]QuarantinedQuote, error)
+	SelectQuarantinedQuote(context.Context, int64) (QuarantinedQuote, error)
+	ResolveQuarantine(context.Context, int64, string) (QuarantinedQuote, error)
+	RollupHistory(context.Context, int) (int64, error)
+	DeleteHistory(context.Context, time.Time, int) (int64, error)
+	DeleteRollups(context.Context, string, time.Time, int) (int64, error)
+	InsertWebhook(context.Context, Webhook) (Webhook, error)
+	SelectWebhooks(context.Context) ([]Webhook, error)
+	DeleteWebhook(context.Context, int64) error
+	InsertWebhookDeliveries(context.Context, string, []byte) (int64, error)
+	ClaimWebhookDeliveries(context.Context, int, time.Duration) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(context.Context, WebhookDelivery) error
+	DeleteWebhookDeliveries(context.Context, time.Time, int) (int64, error)
+	SelectWebhookDeliveries(context.Context, int64, string, int) ([]WebhookDelivery, error)
+	Ping(context.Context) error
 }
 
 type Service struct {
 	repository RepositoryInterface
 	log        *slog.Logger
-	config     *config.Config
+	state      *atomic.Pointer[serviceState]
+	updates    *Broadcaster
+	events     *EventBus
+	lastFetch  *atomic.Int64
+	cache      *readCache
 }
 
+// serviceState is everything that Reload replaces at once.
+type serviceState struct {
+	config   *config.Config
+	provider RateProvider
+}
+
+// NewService creates the service. A nil config leaves it without a provider,
+// which is enough for read-only use.
 func NewService(repository RepositoryInterface, log *slog.Logger, config *config.Config) *Service {
-	return &Service{repository: repository, log: log, config: config}
+	service := &Service{
+		repository: repository,
+		log:        log,
+		state:      &atomic.Pointer[serviceState]{},
+		updates:    NewBroadcaster(),
+		events:     NewEventBus(),
+		lastFetch:  &atomic.Int64{},
+		cache:      &readCache{},
+	}
+
+	service.state.Store(&serviceState{config: config})
+
+	if config != nil {
+		if err := service.Reload(config); err != nil {
+			log.Error("could not create rate provider", slog.Any("error", err))
+		}
+	}
+
+	return service
+}
+
+// Reload switches to conf: the tracked pairs and the provider apply from the next fetch.
+// On error the current configuration is kept.
+func (s Service) Reload(conf *config.Config) error {
+	provider, err := NewRateProvider(conf)
+	if err != nil {
+		return fmt.Errorf("error in Service's method Reload: %w", err)
+	}
+
+	s.state.Store(&serviceState{config: conf, provider: provider})
+
+	return nil
+}
+
+// Config returns the configuration currently in effect.
+func (s Service) Config() *config.Config {
+	return s.state.Load().config
+}
+
+// LastSuccessfulFetch returns when CurrencyMonitor last stored prices,
+// or the zero time if it has not succeeded since start.
+func (s Service) LastSuccessfulFetch() time.Time {
+	nanos := s.lastFetch.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, nanos)
 }
 
+// LastStoredUpdate returns when rates were last stored, according to the
+// repository, or the zero time if none are stored yet.
+func (s Service) LastStoredUpdate(ctx context.Context) (time.Time, error) {
+	currencies, err := s.repository.SelectAllCurrencies(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error in Service's method LastStoredUpdate: %w", err)
+	}
+
+	var last time.Time
+
+	for _, currency := range currencies {
+		if currency.CurrencyLastUpdate.After(last) {
+			last = currency.CurrencyLastUpdate
+		}
+	}
+
+	return last, nil
+}
+
+// CheckDatabase pings the repository's database.
+func (s Service) CheckDatabase(ctx context.Context) error {
+	if err := s.repository.Ping(ctx); err != nil {
+		return fmt.Errorf("error in Service's method CheckDatabase: %w", err)
+	}
+
+	return nil
+}
+
+// Updates returns the broadcaster that receives prices after every successful SetCurrencies.
+func (s Service) Updates() *Broadcaster {
+	return s.updates
+}
+
+// Events returns the bus that RateUpdated, FetchFailed and NewExtreme events are published on.
+func (s Service) Events() *EventBus {
+	return s.events
+}
+
+// GetCurrencies returns all stored currencies, from the cache if it is enabled.
 func (s Service) GetCurrencies(ctx context.Context) ([]Currency, error) {
+	snapshot, err := s.cachedSnapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in method GetCurrencies %w", err)
+	}
+
+	if snapshot != nil {
+		return slices.Clone(snapshot.currencies), nil
+	}
+
 	currencies, err := s.repository.SelectAllCurrencies(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error in method GetCurrencies %w", err)
@@ -41,166 +196,464 @@ func (s Service) GetCurrencies(ctx context.Context) ([]Currency, error) {
 	return currencies, nil
 }
 
+// GetCurrency returns a currency with its min/max prices over the last 24 hours,
+// 7 days, 30 days and all of its history, from the cache if it is enabled.
 func (s Service) GetCurrency(ctx context.Context, currencyName string) (*Currency, error) {
-	currency, err := s.repository.SelectCurrency(ctx, currencyName)
+	snapshot, err := s.cachedSnapshot(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error in method GetCurrency: %w", err)
 	}
 
+	var (
+		currency *Currency
+		cached   bool
+	)
+
+	if snapshot != nil {
+		currency, cached = snapshot.currency(currencyName)
+
+		if extremes, ok := snapshot.cachedExtremes(currencyName); cached && ok {
+			currency.CurrencyExtremes = extremes
+
+			return currency, nil
+		}
+	}
+
+	// A currency stored by another process since the cache was loaded is still found.
+	if !cached {
+		currency, err = s.repository.SelectCurrency(ctx, currencyName)
+		if err != nil {
+			return nil, fmt.Errorf("error in method GetCurrency: %w", err)
+		}
+	}
+
+	now := time.Now()
+	windows := make([]ExtremeWindow, 0, len(extremeWindows))
+
+	for _, window := range extremeWindows {
+		var since time.Time
+		if window.length > 0 {
+			since = now.Add(-window.length)
+		}
+
+		windows = append(windows, ExtremeWindow{Name: window.name, Since: since})
+	}
+
+	currency.CurrencyExtremes, err = s.repository.SelectExtremes(ctx, currencyName, windows)
+	if err != nil {
+		return nil, fmt.Errorf("error in method GetCurrency: %w", err)
+	}
+
+	if cached {
+		snapshot.extremes.Store(currencyName, slices.Clone(currency.CurrencyExtremes))
+	}
+
 	return currency, nil
 }
 
-func (s Service) SetCurrencies(ctx context.Context, data Data) error {
-	currencies, err := s.getCurrentPrice(ctx, data)
+// GetHistory returns the prices of a currency stored between from and to, oldest first.
+// A zero to means now and a zero from means a day before to. Past the raw
+// retention, it returns the close of every hourly and then daily aggregate.
+func (s Service) GetHistory(ctx context.Context, currencyName string, from, to time.Time) ([]HistoryRecord, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if from.IsZero() {
+		from = to.Add(-defaultHistoryWindow)
+	}
+
+	history, err := s.repository.SelectHistory(ctx, currencyName, from, to, s.historyTiers(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("error in Service's method GetHistory: %w", err)
+	}
+
+	return history, nil
+}
+
+// SetCurrencies stores prices, given by currency name, and updates min/max.
+// The prices are taken to be quoted now.
+func (s Service) SetCurrencies(ctx context.Context, prices map[string]string) error {
+	quotes := make(map[string]Quote, len(prices))
+	for name, price := range prices {
+		quotes[name] = Quote{Price: price}
+	}
+
+	_, err := s.storeCurrencies(ctx, quotes)
+
+	return err
+}
+
+// ingestTime returns the current time as Postgres stores it: UTC with microsecond precision.
+func ingestTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// storeCurrencies screens quotes for anomalies and stores the ones that pass.
+func (s Service) storeCurrencies(ctx context.Context, quotes map[string]Quote) ([]Currency, error) {
+	ingested := ingestTime()
+
+	return s.persistCurrencies(ctx, s.screenQuotes(ctx, quotes, ingested), ingested)
+}
+
+func (s Service) persistCurrencies(
+	ctx context.Context, quotes map[string]Quote, ingested time.Time,
+) ([]Currency, error) {
+	if len(quotes) == 0 {
+		return nil, nil
+	}
+
+	var (
+		currencies []Currency
+		extremes   []NewExtreme
+	)
+
+	err := s.repository.InTx(ctx, func(repository RepositoryInterface) error {
+		var err error
+
+		currencies, extremes, err = s.withRepository(repository).insertCurrencies(ctx, quotes, ingested)
+
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("error in Service's method SetCurrency: %w", err)
+		return nil, fmt.Errorf("error in Service's method persistCurrencies: %w", err)
+	}
+
+	s.publishCurrencies(ctx, currencies, extremes)
+
+	return currencies, nil
+}
+
+// insertCurrencies updates min/max for quotes, stores them and queues their
+// webhooks, without publishing them. It is called in a transaction.
+func (s Service) insertCurrencies(
+	ctx context.Context, quotes map[string]Quote, ingested time.Time,
+) ([]Currency, []NewExtreme, error) {
+	currencies, extremes, err := s.getCurrentPrice(ctx, quotes, ingested)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in Service's method insertCurrencies: %w", err)
 	}
 
 	_, err = s.repository.InsertCurrencies(ctx, currencies)
 	if err != nil {
-		return fmt.Errorf("error in Service's method SetCurrency: %w", err)
+		return nil, nil, fmt.Errorf("error in Service's method insertCurrencies: %w", err)
 	}
 
-	return nil
+	events := []Event{RateUpdated{Update: RatesUpdate{Currencies: currencies}}}
+	for _, extreme := range extremes {
+		events = append(events, extreme)
+	}
+
+	if err := s.queueWebhooks(ctx, events...); err != nil {
+		return nil, nil, fmt.Errorf("error in Service's method insertCurrencies: %w", err)
+	}
+
+	return currencies, extremes, nil
 }
 
-func (s Service) GetChangesPerHour(ctx context.Context, currency string) (float64, error) {
-	change, err := s.repository.SelectChangesPerHour(ctx, currency)
+// publishCurrencies refreshes the cache and publishes stored currencies to the
+// streams and the events.
+func (s Service) publishCurrencies(ctx context.Context, currencies []Currency, extremes []NewExtreme) {
+	s.refreshCache(ctx)
+	update := s.updates.Publish(currencies)
+	observeCurrencies(currencies)
+
+	s.events.Publish(RateUpdated{Update: update})
+
+	for _, extreme := range extremes {
+		s.events.Publish(extreme)
+	}
+}
+
+// withRepository returns a copy of the service that queries repository, such as one inside a transaction.
+func (s Service) withRepository(repository RepositoryInterface) Service {
+	s.repository = repository
+
+	return s
+}
+
+// Fetch fetches the tracked pairs from the provider once, stores them and returns what was stored.
+// A failure is also published as a FetchFailed event.
+func (s Service) Fetch(ctx context.Context) ([]Currency, error) {
+	quotes, err := s.fetchPrices(ctx)
 	if err != nil {
-		return -1, fmt.Errorf("error in Service's method GetChangesPerHour: %w", err)
+		s.publishFetchFailed(ctx, err)
+
+		return nil, err
 	}
 
-	return change, nil
+	currencies, err := s.storeCurrencies(ctx, quotes)
+	if err != nil {
+		s.publishFetchFailed(ctx, err)
+
+		return nil, err
+	}
+
+	s.lastFetch.Store(time.Now().UnixNano())
+
+	return currencies, nil
+}
+
+// publishFetchFailed publishes the failure and queues its webhooks.
+func (s Service) publishFetchFailed(ctx context.Context, err error) {
+	var provider string
+	if state := s.state.Load(); state.provider != nil {
+		provider = state.provider.Name()
+	}
+
+	event := FetchFailed{Provider: provider, Err: err, At: time.Now().UTC()}
+	s.events.Publish(event)
+
+	if err := s.queueWebhooks(ctx, event); err != nil {
+		s.log.Error("error in Service's method publishFetchFailed", slog.Any("error", err))
+	}
 }
 
-func (s Service) getCurrentPrice(ctx context.Context, data Data) ([]Currency, error) {
-	var currency Currency
+// WatchStored publishes the stored rates to Updates whenever they differ from
+// the last published ones, checking every interval until ctx is done. It lets a
+// process that does not fetch itself, such as `currency serve` or a replica that
+// does not lead the jobs, stream the rates stored by another one.
+func (s Service) WatchStored(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		loaded := time.Now()
+		currencies, err := s.repository.SelectAllCurrencies(ctx)
+
+		switch {
+		case err != nil && ctx.Err() == nil:
+			s.log.Warn("could not watch stored rates", slog.Any("error", err))
+		case err == nil && len(currencies) > 0:
+			if latest, ok := s.updates.Latest(); !ok || !samePrices(latest.Currencies, currencies) {
+				s.updates.Publish(currencies)
+				observeCurrencies(currencies)
+				s.setCache(currencies, loaded, cacheRefreshWatch)
+			}
+		}
 
-	var minPrice float64
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
-	var maxPrice float64
+// samePrices compares prices by currency name, ignoring order and timestamps.
+func samePrices(a, b []Currency) bool {
+	if len(a) != len(b) {
+		return false
+	}
 
-	currencyAmount := 2
+	prices := make(map[string]decimal.Decimal, len(a))
+	for _, currency := range a {
+		prices[currency.CurrencyName] = currency.CurrencyPrice
+	}
 
-	currencies := make([]Currency, 0, currencyAmount)
+	for _, currency := range b {
+		if price, ok := prices[currency.CurrencyName]; !ok || !price.Equal(currency.CurrencyPrice) {
+			return false
+		}
+	}
 
-	BTCRUB, err := strconv.ParseFloat(data.BTCRUB, 64)
+	return true
+}
+
+// ChatLocation returns the time zone a Telegram chat shows times in: the one set
+// with SetChatTimezone, or else the configured botTimezone.
+func (s Service) ChatLocation(ctx context.Context, chatID int64) *time.Location {
+	name, err := s.repository.SelectChatTimezone(ctx, chatID)
 	if err != nil {
-		return nil, fmt.Errorf("error in Service's method SetCurrencies: %w", err)
+		s.log.Warn("could not load chat timezone", slog.Int64("chat", chatID), slog.Any("error", err))
+	}
+
+	if name == "" && s.Config() != nil {
+		name = s.Config().BotTimezone
 	}
 
-	ETHRUB, err := strconv.ParseFloat(data.ETHRUB, 64)
+	location, err := time.LoadLocation(name)
 	if err != nil {
-		return nil, fmt.Errorf("error in Service's method SetCurrencies: %w", err)
+		return time.UTC
+	}
+
+	return location
+}
+
+// SetChatTimezone stores the IANA time zone, such as Europe/Moscow, that a Telegram chat shows times in.
+func (s Service) SetChatTimezone(ctx context.Context, chatID int64, name string) (*time.Location, error) {
+	location, err := time.LoadLocation(name)
+	if err != nil || name == "" || name == "Local" {
+		return nil, fmt.Errorf("error in Service's method SetChatTimezone: %w: %q", errTimezone, name)
 	}
 
-	currencyData := [2]struct {
-		Name  string
-		Price float64
-	}{
-		{
-			"BTC",
-			BTCRUB,
-		},
-		{
-			"ETH",
-			ETHRUB,
-		},
+	if err := s.repository.SetChatTimezone(ctx, chatID, location.String()); err != nil {
+		return nil, fmt.Errorf("error in Service's method SetChatTimezone: %w", err)
 	}
 
-	for _, curr := range currencyData {
-		currentData, _ := s.repository.SelectCurrency(ctx, curr.Name)
+	return location, nil
+}
+
+func (s Service) GetChangesPerHour(ctx context.Context, currency string) (decimal.Decimal, error) {
+	change, err := s.repository.SelectChangesPerHour(ctx, currency)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("error in Service's method GetChangesPerHour: %w", err)
+	}
+
+	return change, nil
+}
+
+// getCurrentPrice builds the currencies to store from quotes by currency name,
+// stamped as ingested at ingested and, unless the quote has a time, quoted then too.
+// It also returns the prices that go beyond a stored all-time min/max.
+func (s Service) getCurrentPrice(
+	ctx context.Context, quotes map[string]Quote, ingested time.Time,
+) ([]Currency, []NewExtreme, error) {
+	var minPrice decimal.Decimal
+
+	var maxPrice decimal.Decimal
+
+	currencies := make([]Currency, 0, len(quotes))
+
+	var extremes []NewExtreme
+
+	names := make([]string, 0, len(quotes))
+	for name := range quotes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		price, err := decimal.NewFromString(quotes[name].Price)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error in Service's method getCurrentPrice: %s: %w", name, err)
+		}
+
+		price = s.roundPrice(name, price)
+
+		currentData, _ := s.repository.SelectCurrency(ctx, name)
 
 		if currentData == nil {
-			minPrice = curr.Price
-			maxPrice = curr.Price
+			minPrice = price
+			maxPrice = price
 		} else {
-			minPrice = s.updateMinPrice(curr.Price, currentData.CurrencyMinPrice)
-			maxPrice = s.updateMaxPrice(curr.Price, currentData.CurrencyMaxPrice)
+			minPrice = s.updateMinPrice(price, currentData.CurrencyMinPrice)
+			maxPrice = s.updateMaxPrice(price, currentData.CurrencyMaxPrice)
+		}
+
+		quoted := ingested
+		if !quotes[name].Time.IsZero() {
+			quoted = quotes[name].Time.UTC().Truncate(time.Microsecond)
+		}
+
+		if currentData != nil && price.LessThan(currentData.CurrencyMinPrice) {
+			extremes = append(extremes, NewExtreme{
+				CurrencyName: name, Kind: ExtremeMin, Price: price, Previous: currentData.CurrencyMinPrice, QuotedAt: quoted,
+			})
 		}
 
-		currency.CurrencyName = curr.Name
-		currency.CurrencyPrice = curr.Price
-		currency.CurrencyMinPrice = minPrice
-		currency.CurrencyMaxPrice = maxPrice
-		currency.CurrencyChangePerHour = 0.0
+		if currentData != nil && price.GreaterThan(currentData.CurrencyMaxPrice) {
+			extremes = append(extremes, NewExtreme{
+				CurrencyName: name, Kind: ExtremeMax, Price: price, Previous: currentData.CurrencyMaxPrice, QuotedAt: quoted,
+			})
+		}
 
-		currencies = append(currencies, currency)
+		currencies = append(currencies, Currency{
+			CurrencyName:       name,
+			CurrencyPrice:      price,
+			CurrencyMinPrice:   minPrice,
+			CurrencyMaxPrice:   maxPrice,
+			CurrencyLastUpdate: ingested,
+			CurrencyQuotedAt:   quoted,
+		})
 	}
 
-	return currencies, nil
+	return currencies, extremes, nil
 }
 
-func (s Service) CurrencyMonitor() {
-	data := s.getMonitorData()
+// roundPrice rounds price to the scale configured for the currency, if any.
+func (s Service) roundPrice(name string, price decimal.Decimal) decimal.Decimal {
+	conf := s.Config()
+	if conf == nil {
+		return price
+	}
 
-	err := s.SetCurrencies(context.Background(), data.Data)
-	if err != nil {
-		s.log.Error("error in Endpoint's method CurrentMonitor: %w", err)
+	if scale, ok := conf.Scale(name); ok {
+		return price.Round(scale)
 	}
+
+	return price
 }
 
-func (s Service) updateMinPrice(currPrice, currentMinPrice float64) float64 {
-	if currPrice < currentMinPrice {
+func (s Service) CurrencyMonitor() {
+	if _, err := s.Fetch(context.Background()); err != nil {
+		s.log.Error("could not update rates", slog.Any("error", err))
+	}
+}
+
+func (s Service) updateMinPrice(currPrice, currentMinPrice decimal.Decimal) decimal.Decimal {
+	if currPrice.LessThan(currentMinPrice) {
 		return currPrice
 	}
 
 	return currentMinPrice
 }
 
-func (s Service) updateMaxPrice(currPrice, currentMaxPrice float64) float64 {
-	if currPrice > currentMaxPrice {
+func (s Service) updateMaxPrice(currPrice, currentMaxPrice decimal.Decimal) decimal.Decimal {
+	if currPrice.GreaterThan(currentMaxPrice) {
 		return currPrice
 	}
 
 	return currentMaxPrice
 }
 
-func (s Service) getMonitorData() *DataCurrencyMonitor {
-	var data DataCurrencyMonitor
-
-	timeout := 5
-
-	timeOutClient := 3
-
-	transport := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: time.Duration(timeout) * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: time.Duration(timeout) * time.Second,
+// fetchPrices asks the current provider for the tracked pairs and returns
+// the quotes by currency name. Pairs missing from the response are logged.
+func (s Service) fetchPrices(ctx context.Context) (prices map[string]Quote, err error) {
+	state := s.state.Load()
+	if state.provider == nil {
+		return nil, errNoProvider
 	}
 
-	url := "https://currate.ru/api/?get=rates&pairs=BTCRUB,ETHRUB&key=" + s.config.APIKey
+	started := time.Now()
 
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
-	if err != nil {
-		s.log.Error("error in Endpoint's method CurrencyMonitor: " + err.Error())
-	}
+	defer func() {
+		observeFetch(state.provider.Name(), started, err)
+	}()
 
-	req.Header.Set("Content-Type", "application/json")
+	names := state.config.CurrencyNames()
+	pairs := make([]string, 0, len(names))
 
-	client := &http.Client{
-		Timeout:   time.Duration(timeOutClient) * time.Second,
-		Transport: transport,
+	for _, name := range names {
+		pairs = append(pairs, state.config.Pairs[name])
 	}
 
-	resp, err := client.Do(req)
+	quotes, err := state.provider.FetchRates(ctx, pairs)
 	if err != nil {
-		s.log.Error("error in Endpoint's method CurrencyMonitor: " + err.Error())
+		return nil, fmt.Errorf("error in Service's method fetchPrices: %s: %w", state.provider.Name(), err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		s.log.Error("error in Endpoint's method CurrencyMonitor: " + err.Error())
+	byPair := make(map[string]Quote, len(quotes))
+	for _, quote := range quotes {
+		byPair[quote.Pair] = quote
 	}
 
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		s.log.Error("error in Endpoint's method CurrencyMonitor: ", err)
+	prices = make(map[string]Quote, len(names))
+
+	for _, name := range names {
+		price, ok := byPair[state.config.Pairs[name]]
+		if !ok {
+			s.log.Warn("provider returned no price", slog.String("provider", state.provider.Name()),
+				slog.String("currency", name), slog.String("pair", state.config.Pairs[name]))
+
+			continue
+		}
+
+		prices[name] = price
 	}
 
-	return &data
+	return prices, nil
 }
 
 func (s Service) SetChangesPerHour() {
@@ -208,39 +661,42 @@ func (s Service) SetChangesPerHour() {
 
 	currenciesInDB, err := s.repository.SelectAllCurrencies(context.Background())
 	if err != nil {
-		s.log.Error("error in method GetCurrency: %w", err)
-	}
+		s.log.Error("could not load currencies for hourly change", slog.Any("error", err))
 
-	currentData := s.getMonitorData()
+		return
+	}
 
+	prices, err := s.fetchPrices(context.Background())
 	if err != nil {
-		s.log.Error("error in method SetChangesPerHourn: %w", err)
+		s.log.Error("could not fetch rates", slog.Any("error", err))
+
+		return
 	}
 
 	for _, curr := range currenciesInDB {
-		if curr.CurrencyName == "BTC" {
-			data, err := strconv.ParseFloat(currentData.Data.BTCRUB, 64)
-			if err != nil {
-				s.log.Error("error in method SetChangesPerHourn: %w", err)
-			}
-
-			curr.CurrencyChangePerHour = data - curr.CurrencyPrice
-			currency = append(currency, curr)
+		quote, ok := prices[curr.CurrencyName]
+		if !ok {
+			continue
 		}
 
-		if curr.CurrencyName == "ETH" {
-			data, err := strconv.ParseFloat(currentData.Data.ETHRUB, 64)
-			if err != nil {
-				s.log.Error("error in method SetChangesPerHourn: %w", err)
-			}
+		data, err := decimal.NewFromString(quote.Price)
+		if err != nil {
+			s.log.Error("could not parse provider price", slog.String("currency", curr.CurrencyName),
+				slog.String("price", quote.Price), slog.Any("error", err))
 
-			curr.CurrencyChangePerHour = data - curr.CurrencyPrice
-			currency = append(currency, curr)
+			continue
 		}
+
+		curr.CurrencyChangePerHour = s.roundPrice(curr.CurrencyName, data).Sub(curr.CurrencyPrice)
+		currency = append(currency, curr)
 	}
 
 	err = s.repository.SetChangesPerHour(context.Background(), currency)
 	if err != nil {
-		s.log.Error("error in Service's method SetChangesPerHour: %w", err)
+		s.log.Error("could not store hourly change", slog.Any("error", err))
+
+		return
 	}
+
+	s.invalidateCache()
 }
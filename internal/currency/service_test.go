@@ -5,9 +5,12 @@ import (
 	"errors"
 	"log/slog"
 	"os"
+	"slices"
 	"testing"
 	"time"
 
+	"github.com/crackc0der/currency/config"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -47,10 +50,10 @@ func TestSelectAllCurrencies(t *testing.T) {
 						{
 							CurrencyID:            1,
 							CurrencyName:          "USD",
-							CurrencyPrice:         90.42,
-							CurrencyMinPrice:      27.00,
-							CurrencyMaxPrice:      120.00,
-							CurrencyChangePerHour: 11.42,
+							CurrencyPrice:         decimal.RequireFromString("90.42"),
+							CurrencyMinPrice:      decimal.RequireFromString("27.00"),
+							CurrencyMaxPrice:      decimal.RequireFromString("120.00"),
+							CurrencyChangePerHour: decimal.RequireFromString("11.42"),
 							CurrencyLastUpdate:    time,
 						},
 					},
@@ -61,10 +64,10 @@ func TestSelectAllCurrencies(t *testing.T) {
 				{
 					CurrencyID:            1,
 					CurrencyName:          "USD",
-					CurrencyPrice:         90.42,
-					CurrencyMinPrice:      27.00,
-					CurrencyMaxPrice:      120.00,
-					CurrencyChangePerHour: 11.42,
+					CurrencyPrice:         decimal.RequireFromString("90.42"),
+					CurrencyMinPrice:      decimal.RequireFromString("27.00"),
+					CurrencyMaxPrice:      decimal.RequireFromString("120.00"),
+					CurrencyChangePerHour: decimal.RequireFromString("11.42"),
 					CurrencyLastUpdate:    time,
 				},
 			},
@@ -140,15 +143,22 @@ func TestSelectCurrency(t *testing.T) {
 					&Currency{
 						CurrencyID:            1,
 						CurrencyName:          "USD",
-						CurrencyPrice:         90.42,
-						CurrencyMinPrice:      27.00,
-						CurrencyMaxPrice:      120.00,
-						CurrencyChangePerHour: 11.42,
+						CurrencyPrice:         decimal.RequireFromString("90.42"),
+						CurrencyMinPrice:      decimal.RequireFromString("27.00"),
+						CurrencyMaxPrice:      decimal.RequireFromString("120.00"),
+						CurrencyChangePerHour: decimal.RequireFromString("11.42"),
 						CurrencyLastUpdate:    time,
 					},
 					"USD",
 					nil,
 				)
+				repo.On("SelectExtremes", mock.Anything, "USD", mock.MatchedBy(func(windows []ExtremeWindow) bool {
+					return len(windows) == 4 && windows[0].Name == "24h" && windows[3].Since.IsZero()
+				})).Return([]WindowExtremes{{
+					Window: "24h",
+					Min:    Extreme{Price: decimal.RequireFromString("89.5"), At: time},
+					Max:    Extreme{Price: decimal.RequireFromString("91"), At: time},
+				}}, nil)
 			},
 			args: args{
 				name: "USD",
@@ -156,11 +166,16 @@ func TestSelectCurrency(t *testing.T) {
 			want: &Currency{
 				CurrencyID:            1,
 				CurrencyName:          "USD",
-				CurrencyPrice:         90.42,
-				CurrencyMinPrice:      27.00,
-				CurrencyMaxPrice:      120.00,
-				CurrencyChangePerHour: 11.42,
+				CurrencyPrice:         decimal.RequireFromString("90.42"),
+				CurrencyMinPrice:      decimal.RequireFromString("27.00"),
+				CurrencyMaxPrice:      decimal.RequireFromString("120.00"),
+				CurrencyChangePerHour: decimal.RequireFromString("11.42"),
 				CurrencyLastUpdate:    time,
+				CurrencyExtremes: []WindowExtremes{{
+					Window: "24h",
+					Min:    Extreme{Price: decimal.RequireFromString("89.5"), At: time},
+					Max:    Extreme{Price: decimal.RequireFromString("91"), At: time},
+				}},
 			},
 			wantErr: nil,
 		},
@@ -210,7 +225,7 @@ func TestSelectCurrency(t *testing.T) {
 }
 
 func TestSelectChangesPerHour(t *testing.T) {
-	// SelectChangesPerHour(ctx context.Context, curr string) (float64, error)
+	// SelectChangesPerHour(ctx context.Context, curr string) (decimal.Decimal, error)
 	t.Parallel()
 
 	repo := new(MockRepo)
@@ -219,7 +234,7 @@ func TestSelectChangesPerHour(t *testing.T) {
 		name string
 	}
 
-	setList := func(name string, change float64, err error) {
+	setList := func(name string, change decimal.Decimal, err error) {
 		repo.On("SelectChangesPerHour", mock.Anything, name).Return(change, err)
 	}
 
@@ -227,7 +242,7 @@ func TestSelectChangesPerHour(t *testing.T) {
 		name    string
 		setup   func()
 		args    args
-		want    float64
+		want    decimal.Decimal
 		wantErr error
 	}{
 		{
@@ -235,36 +250,36 @@ func TestSelectChangesPerHour(t *testing.T) {
 			setup: func() {
 				setList(
 					"USD",
-					11.42,
+					decimal.RequireFromString("11.42"),
 					nil,
 				)
 			},
 			args: args{
 				name: "USD",
 			},
-			want:    11.42,
+			want:    decimal.RequireFromString("11.42"),
 			wantErr: nil,
 		},
 		{
 			name: "some error",
 			setup: func() {
-				setList("ETH", -1, ErrNoCurrencies)
+				setList("ETH", decimal.Zero, ErrNoCurrencies)
 			},
 			args: args{
 				name: "ETH",
 			},
-			want:    -1,
+			want:    decimal.Zero,
 			wantErr: ErrGetChangesPerHour,
 		},
 		{
 			name: "empty list",
 			setup: func() {
-				setList("", -1, ErrNoCurrencies)
+				setList("", decimal.Zero, ErrNoCurrencies)
 			},
 			args: args{
 				name: "",
 			},
-			want:    -1,
+			want:    decimal.Zero,
 			wantErr: ErrGetChangesPerHour,
 		},
 	}
@@ -285,7 +300,7 @@ func TestSelectChangesPerHour(t *testing.T) {
 				require.NoError(t, testCase.wantErr)
 			}
 
-			assert.InEpsilon(t, testCase.want, got, 0.0001)
+			assert.True(t, testCase.want.Equal(got), "want %s, got %s", testCase.want, got)
 		})
 	}
 }
@@ -293,3 +308,116 @@ func TestSelectChangesPerHour(t *testing.T) {
 // func TestSetChangesPerHour(t *testing.T) {
 // 	// SetChangesPerHour(ctx context.Context, currencies []Currency) error
 // }
+
+func TestWatchStoredPublishesChanges(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency{
+		{CurrencyName: "BTC", CurrencyPrice: decimal.RequireFromString("100")},
+		{CurrencyName: "ETH", CurrencyPrice: decimal.RequireFromString("10")},
+	}, nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// With a cancelled context every call polls once and returns.
+	svc.WatchStored(ctx, time.Hour)
+	svc.WatchStored(ctx, time.Hour)
+
+	latest, ok := svc.Updates().Latest()
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), latest.ID, "unchanged prices must not be published again")
+
+	svc.Updates().Publish([]Currency{
+		{CurrencyName: "BTC", CurrencyPrice: decimal.RequireFromString("101")},
+		{CurrencyName: "ETH", CurrencyPrice: decimal.RequireFromString("10")},
+	})
+	svc.WatchStored(ctx, time.Hour)
+
+	latest, _ = svc.Updates().Latest()
+	assert.Equal(t, uint64(3), latest.ID)
+}
+
+func TestSetCurrenciesKeepsExactPrices(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName:     "BTC",
+		CurrencyMinPrice: decimal.RequireFromString("0.3"),
+		CurrencyMaxPrice: decimal.RequireFromString("0.3"),
+	}, nil)
+	repo.On("SelectCurrency", mock.Anything, "ETH").Return((*Currency)(nil), ErrNoCurrencies)
+	repo.On("SelectLatestHistory", mock.Anything, mock.Anything, mock.Anything).Return([]HistoryRecord(nil), nil)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+	repo.On("SelectAllCurrencies", mock.Anything).Return([]Currency(nil), nil)
+
+	conf := config.Default()
+	conf.Scales = map[string]int{"ETH": 2}
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	require.NoError(t, svc.SetCurrencies(context.Background(), map[string]string{"BTC": "0.30", "ETH": "210000.505"}))
+
+	i := slices.IndexFunc(repo.Calls, func(call mock.Call) bool { return call.Method == "InsertCurrencies" })
+	require.NotEqual(t, -1, i)
+
+	stored, ok := repo.Calls[i].Arguments.Get(1).([]Currency)
+	require.True(t, ok)
+	require.Len(t, stored, 2)
+
+	assert.Equal(t, "0.3", stored[0].CurrencyPrice.String())
+	assert.Equal(t, "0.3", stored[0].CurrencyMaxPrice.String())
+	assert.Equal(t, "210000.51", stored[1].CurrencyPrice.String(), "ETH is rounded to its scale")
+}
+
+func TestChatLocation(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("SelectChatTimezone", mock.Anything, int64(1)).Return("Asia/Tokyo", nil)
+	repo.On("SelectChatTimezone", mock.Anything, int64(2)).Return("", nil)
+	repo.On("SetChatTimezone", mock.Anything, int64(2), "Europe/Moscow").Return(nil)
+
+	conf := config.Default()
+	conf.BotTimezone = "Europe/Berlin"
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	assert.Equal(t, "Asia/Tokyo", svc.ChatLocation(context.Background(), 1).String())
+	assert.Equal(t, "Europe/Berlin", svc.ChatLocation(context.Background(), 2).String(), "falls back to botTimezone")
+
+	location, err := svc.SetChatTimezone(context.Background(), 2, "Europe/Moscow")
+	require.NoError(t, err)
+	assert.Equal(t, "Europe/Moscow", location.String())
+
+	_, err = svc.SetChatTimezone(context.Background(), 2, "Mars/Olympus")
+	require.ErrorIs(t, err, errTimezone)
+}
+
+func TestFetchKeepsQuoteAndIngestTimes(t *testing.T) {
+	t.Parallel()
+
+	quoted := time.Date(2024, 1, 31, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+
+	repo := new(MockRepo)
+	repo.On("SelectCurrency", mock.Anything, mock.Anything).Return((*Currency)(nil), ErrNoCurrencies)
+	repo.On("InsertCurrencies", mock.Anything, mock.Anything).Return([]Currency(nil), nil)
+	repo.On("InsertWebhookDeliveries", mock.Anything, mock.Anything, mock.Anything).Return(int64(0), nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	currencies, err := svc.storeCurrencies(context.Background(), map[string]Quote{
+		"BTC": {Pair: "BTCRUB", Price: "3850000", Time: quoted},
+		"ETH": {Pair: "ETHRUB", Price: "210000"},
+	})
+	require.NoError(t, err)
+	require.Len(t, currencies, 2)
+
+	assert.Equal(t, time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC), currencies[0].CurrencyQuotedAt)
+	assert.Equal(t, time.UTC, currencies[0].CurrencyLastUpdate.Location())
+	assert.Equal(t, currencies[1].CurrencyLastUpdate, currencies[1].CurrencyQuotedAt,
+		"a quote without a time is taken to be quoted when it was stored")
+}
@@ -0,0 +1,178 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	defaultStatsWindow = 7 * 24 * time.Hour
+	year               = 365 * 24 * time.Hour
+)
+
+// Stats summarizes the stored prices of a currency between From and To. Like
+// prices, every figure is an exact decimal, serialized as a string. Return and
+// MaxDrawdown are fractions, so 0.05 is 5%. StdDev and the log returns behind
+// AnnualizedVolatility are sample statistics, which need at least two prices.
+type Stats struct {
+	Currency             string          `json:"currency"`
+	From                 time.Time       `json:"from"`
+	To                   time.Time       `json:"to"`
+	Count                int             `json:"count"`
+	Mean                 decimal.Decimal `json:"mean"`
+	Median               decimal.Decimal `json:"median"`
+	StdDev               decimal.Decimal `json:"stdDev"`
+	AnnualizedVolatility decimal.Decimal `json:"annualizedVolatility"`
+	MaxDrawdown          decimal.Decimal `json:"maxDrawdown"`
+	Return               decimal.Decimal `json:"return"`
+}
+
+// GetStats computes the statistics of the prices stored between from and to.
+// A zero to means now and a zero from means a week before to. Past the raw
+// retention, the statistics are of hourly and then daily closes, like GetHistory.
+func (s Service) GetStats(ctx context.Context, currencyName string, from, to time.Time) (Stats, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	if from.IsZero() {
+		from = to.Add(-defaultStatsWindow)
+	}
+
+	if from.After(to) {
+		return Stats{}, fmt.Errorf("error in Service's method GetStats: %w", errInvalidTimeRange)
+	}
+
+	history, err := s.repository.SelectHistory(ctx, currencyName, from, to, s.historyTiers(time.Now()))
+	if err != nil {
+		return Stats{}, fmt.Errorf("error in Service's method GetStats: %w", err)
+	}
+
+	stats := computeStats(history)
+	stats.Currency = currencyName
+	stats.From = from.UTC()
+	stats.To = to.UTC()
+
+	return stats, nil
+}
+
+// computeStats expects history ordered oldest first. Quotients are rounded to
+// decimal.DivisionPrecision places.
+func computeStats(history []HistoryRecord) Stats {
+	stats := Stats{Count: len(history)}
+	if len(history) == 0 {
+		return stats
+	}
+
+	prices := make([]decimal.Decimal, 0, len(history))
+	for _, record := range history {
+		prices = append(prices, record.CurrencyPrice)
+	}
+
+	stats.Mean = decimal.Avg(prices[0], prices[1:]...)
+	stats.Median = median(prices)
+	stats.MaxDrawdown = maxDrawdown(prices)
+
+	if first := prices[0]; !first.IsZero() {
+		stats.Return = prices[len(prices)-1].Div(first).Sub(decimal.NewFromInt(1))
+	}
+
+	if len(prices) < 2 {
+		return stats
+	}
+
+	stats.StdDev = decimalStdDev(prices, stats.Mean)
+
+	// Log returns have no exact decimal form, so the volatility is computed in
+	// floating point and scaled by the number of sampling intervals in a year.
+	logReturns := make([]float64, 0, len(prices)-1)
+
+	for i := 1; i < len(prices); i++ {
+		if prices[i-1].IsPositive() && prices[i].IsPositive() {
+			logReturns = append(logReturns, math.Log(prices[i].Div(prices[i-1]).InexactFloat64()))
+		}
+	}
+
+	span := history[len(history)-1].CreatedAt.Sub(history[0].CreatedAt)
+
+	if len(logReturns) >= 2 && span > 0 {
+		var returnSum float64
+		for _, logReturn := range logReturns {
+			returnSum += logReturn
+		}
+
+		step := span / time.Duration(len(prices)-1)
+		volatility := sampleStdDev(logReturns, returnSum/float64(len(logReturns))) *
+			math.Sqrt(float64(year)/float64(step))
+		stats.AnnualizedVolatility = decimal.NewFromFloat(volatility).Round(int32(decimal.DivisionPrecision))
+	}
+
+	return stats
+}
+
+func median(values []decimal.Decimal) decimal.Decimal {
+	sorted := slices.Clone(values)
+	slices.SortFunc(sorted, func(a, b decimal.Decimal) int { return a.Cmp(b) })
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return decimal.Avg(sorted[middle-1], sorted[middle])
+	}
+
+	return sorted[middle]
+}
+
+func sampleStdDev(values []float64, mean float64) float64 {
+	var sum float64
+	for _, value := range values {
+		sum += (value - mean) * (value - mean)
+	}
+
+	return math.Sqrt(sum / float64(len(values)-1))
+}
+
+func decimalStdDev(values []decimal.Decimal, mean decimal.Decimal) decimal.Decimal {
+	var sum decimal.Decimal
+	for _, value := range values {
+		deviation := value.Sub(mean)
+		sum = sum.Add(deviation.Mul(deviation))
+	}
+
+	return sqrt(sum.Div(decimal.NewFromInt(int64(len(values) - 1))))
+}
+
+// sqrt refines the floating-point square root of value by Newton's method.
+func sqrt(value decimal.Decimal) decimal.Decimal {
+	if !value.IsPositive() {
+		return decimal.Zero
+	}
+
+	two := decimal.NewFromInt(2) //nolint:mnd
+	root := decimal.NewFromFloat(math.Sqrt(value.InexactFloat64()))
+
+	for range 3 {
+		root = root.Add(value.Div(root)).Div(two)
+	}
+
+	return root.Round(int32(decimal.DivisionPrecision))
+}
+
+// maxDrawdown is the largest fall from a running peak, as a fraction of the peak.
+func maxDrawdown(prices []decimal.Decimal) decimal.Decimal {
+	var peak, drawdown decimal.Decimal
+
+	for _, price := range prices {
+		peak = decimal.Max(peak, price)
+
+		if peak.IsPositive() {
+			drawdown = decimal.Max(drawdown, peak.Sub(price).Div(peak))
+		}
+	}
+
+	return drawdown
+}
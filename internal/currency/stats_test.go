@@ -0,0 +1,86 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStats(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 7)
+
+	var history []HistoryRecord
+
+	for i, price := range []string{"100", "110", "99", "121"} {
+		history = append(history, HistoryRecord{
+			CurrencyName:  "BTC",
+			CurrencyPrice: decimal.RequireFromString(price),
+			CreatedAt:     from.AddDate(0, 0, i),
+		})
+	}
+
+	repo := new(MockRepo)
+	repo.On("SelectHistory", mock.Anything, "BTC", from, to, mock.Anything).Return(history, nil)
+	repo.On("SelectHistory", mock.Anything, "ETH", from, to, mock.Anything).Return([]HistoryRecord(nil), nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	stats, err := svc.GetStats(context.Background(), "BTC", from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, stats.Count)
+	assert.Equal(t, "107.5", stats.Mean.String())
+	assert.Equal(t, "105", stats.Median.String())
+	assert.Equal(t, "10.2794292967395163", stats.StdDev.String(), "sqrt(317/3) to 16 places")
+	assert.InDelta(t, 2.97024140395538, stats.AnnualizedVolatility.InexactFloat64(), 1e-9,
+		"daily log returns scaled by sqrt(365)")
+	assert.Equal(t, "0.1", stats.MaxDrawdown.String(), "from 110 down to 99")
+	assert.Equal(t, "0.21", stats.Return.String())
+
+	// Prices are exact decimals, and so are the figures derived from them.
+	encoded, err := json.Marshal(stats)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"mean":"107.5"`)
+	assert.Contains(t, string(encoded), `"return":"0.21"`)
+
+	stats, err = svc.GetStats(context.Background(), "ETH", from, to)
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Currency: "ETH", From: from, To: to}, stats)
+
+	_, err = svc.GetStats(context.Background(), "BTC", to, from)
+	require.ErrorIs(t, err, errInvalidTimeRange)
+}
+
+func TestGetStatsReadsRollupsPastRetention(t *testing.T) {
+	t.Parallel()
+
+	to := time.Now().UTC()
+	from := to.AddDate(-1, 0, 0)
+
+	conf := config.Default()
+	conf.Retention = config.Retention{RawDays: 30, HourlyDays: 90, BatchSize: 2}
+
+	repo := new(MockRepo)
+	repo.On("SelectHistory", mock.Anything, "BTC", from, to, mock.MatchedBy(func(tiers HistoryTiers) bool {
+		return to.Sub(tiers.Raw).Round(time.Hour) == 30*24*time.Hour &&
+			to.Sub(tiers.Hourly).Round(time.Hour) == 90*24*time.Hour
+	})).Return([]HistoryRecord(nil), nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	_, err := svc.GetStats(context.Background(), "BTC", from, to)
+	require.NoError(t, err)
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,491 @@
+package currency
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/crackc0der/currency/internal/redact"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+
+	// Webhook requests carry these headers. The signature is the hex HMAC-SHA256,
+	// keyed with the webhook's secret, of the timestamp, a dot and the body.
+	HeaderWebhookEvent     = "X-Currency-Event"
+	HeaderWebhookDelivery  = "X-Currency-Delivery"
+	HeaderWebhookTimestamp = "X-Currency-Timestamp"
+	HeaderWebhookSignature = "X-Currency-Signature"
+
+	webhookSecretBytes = 32
+	// webhookBatchSize is the number of webhooks sent to at once.
+	webhookBatchSize     = 100
+	webhookDeliveryLimit = 100
+	// webhookErrorLimit bounds the response body or error kept in the delivery log.
+	webhookErrorLimit = 1024
+)
+
+var (
+	errWebhookURL      = errors.New("webhook url must be an absolute http or https URL")
+	errWebhookTarget   = errors.New("webhook url must resolve to public addresses only")
+	errWebhookEvents   = errors.New("webhook events must be some of rate_updated, fetch_failed, new_extreme")
+	errWebhookNotFound = errors.New("webhook not found")
+	errDeliveryStatus  = errors.New("status must be one of pending, delivered, failed")
+	errWebhookStatus   = errors.New("unexpected webhook response status")
+)
+
+// webhookEvents are the events that webhooks can subscribe to.
+//
+//nolint:gochecknoglobals
+var webhookEvents = []string{EventRateUpdated, EventFetchFailed, EventNewExtreme}
+
+// Webhook receives the events it subscribed to as signed JSON. Secret is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is one event queued for one webhook, and its delivery log.
+type WebhookDelivery struct {
+	ID            int64           `json:"id"`
+	WebhookID     int64           `json:"webhookId"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	LastStatus    *int            `json:"lastStatus,omitempty"`
+	LastError     *string         `json:"lastError,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	DeliveredAt   *time.Time      `json:"deliveredAt,omitempty"`
+	// URL and Secret are those of the webhook, loaded to send the delivery.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurredAt"`
+	Data       any       `json:"data"`
+}
+
+type rateUpdatedData struct {
+	Currencies []Currency `json:"currencies"`
+}
+
+type fetchFailedData struct {
+	Provider string `json:"provider"`
+	Error    string `json:"error"`
+}
+
+type newExtremeData struct {
+	CurrencyName string          `json:"currencyName"`
+	Kind         string          `json:"kind"`
+	Price        decimal.Decimal `json:"price"`
+	Previous     decimal.Decimal `json:"previous"`
+	QuotedAt     time.Time       `json:"quotedAt"`
+}
+
+// CreateWebhook registers rawURL for events. An empty secret is replaced by a
+// random one, which is returned. The URL's host must resolve to public addresses
+// only, so that webhooks cannot reach services in the network the service runs in.
+func (s Service) CreateWebhook(ctx context.Context, rawURL string, events []string, secret string) (Webhook, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !parsed.IsAbs() || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w, got %q", errWebhookURL, rawURL)
+	}
+
+	if len(events) == 0 {
+		return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w", errWebhookEvents)
+	}
+
+	for _, event := range events {
+		if !slices.Contains(webhookEvents, event) {
+			return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w, got %q", errWebhookEvents, event)
+		}
+	}
+
+	if err := checkWebhookHost(ctx, parsed.Hostname()); err != nil {
+		return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w", err)
+	}
+
+	if secret == "" {
+		random := make([]byte, webhookSecretBytes)
+		if _, err := rand.Read(random); err != nil {
+			return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w", err)
+		}
+
+		secret = hex.EncodeToString(random)
+	}
+
+	events = slices.Clone(events)
+	slices.Sort(events)
+
+	webhook, err := s.repository.InsertWebhook(ctx, Webhook{URL: rawURL, Events: slices.Compact(events), Secret: secret})
+	if err != nil {
+		return Webhook{}, fmt.Errorf("error in Service's method CreateWebhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+// checkWebhookHost resolves host and rejects it unless all of its addresses are public.
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errWebhookTarget, err)
+	}
+
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w, got %s", errWebhookTarget, addr)
+		}
+	}
+
+	return nil
+}
+
+// publicAddr reports whether addr is a global unicast address outside the private
+// ranges, which excludes loopback, link-local, unspecified and multicast addresses.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// ListWebhooks returns the registered webhooks without their secrets.
+func (s Service) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks, err := s.repository.SelectWebhooks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in Service's method ListWebhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func (s Service) DeleteWebhook(ctx context.Context, id int64) error {
+	err := s.repository.DeleteWebhook(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("error in Service's method DeleteWebhook: %w: %d", errWebhookNotFound, id)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error in Service's method DeleteWebhook: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook with status,
+// or with any status if it is empty, newest first.
+func (s Service) ListWebhookDeliveries(ctx context.Context, webhookID int64, status string) ([]WebhookDelivery, error) {
+	switch status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryFailed:
+	default:
+		return nil, fmt.Errorf("error in Service's method ListWebhookDeliveries: %w, got %q", errDeliveryStatus, status)
+	}
+
+	deliveries, err := s.repository.SelectWebhookDeliveries(ctx, webhookID, status, webhookDeliveryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error in Service's method ListWebhookDeliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// queueWebhooks stores a delivery of every event for each webhook subscribed to
+// it. Called with a repository in a transaction, the deliveries are committed
+// together with what the events report, so none is lost or sent for a rollback.
+func (s Service) queueWebhooks(ctx context.Context, events ...Event) error {
+	for _, event := range events {
+		payload, err := json.Marshal(s.webhookPayload(event))
+		if err != nil {
+			return fmt.Errorf("error in Service's method queueWebhooks: %w", err)
+		}
+
+		if _, err := s.repository.InsertWebhookDeliveries(ctx, event.EventName(), payload); err != nil {
+			return fmt.Errorf("error in Service's method queueWebhooks: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s Service) webhookPayload(event Event) webhookPayload {
+	payload := webhookPayload{Event: event.EventName(), OccurredAt: time.Now().UTC()}
+
+	switch event := event.(type) {
+	case RateUpdated:
+		payload.Data = rateUpdatedData{Currencies: event.Update.Currencies}
+	case FetchFailed:
+		payload.OccurredAt = event.At
+
+		// Provider errors can hold the API key in a URL.
+		var secrets []string
+		if conf := s.Config(); conf != nil {
+			secrets = conf.Secrets()
+		}
+
+		payload.Data = fetchFailedData{
+			Provider: event.Provider,
+			Error:    redact.New(secrets...).String(event.Err.Error()),
+		}
+	case NewExtreme:
+		payload.Data = newExtremeData{
+			CurrencyName: event.CurrencyName,
+			Kind:         event.Kind,
+			Price:        event.Price,
+			Previous:     event.Previous,
+			QuotedAt:     event.QuotedAt,
+		}
+	}
+
+	return payload
+}
+
+// DeliverWebhooks sends due deliveries every webhooks.pollInterval until ctx is done.
+func (s Service) DeliverWebhooks(ctx context.Context) {
+	transport := newWebhookTransport()
+
+	for {
+		conf := s.Config().Webhooks
+		client := newWebhookClient(transport, time.Duration(conf.Timeout)*time.Second)
+
+		if err := s.deliverDueWebhooks(ctx, client); err != nil && ctx.Err() == nil {
+			s.log.Error("could not deliver webhooks", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(conf.PollInterval) * time.Second):
+		}
+	}
+}
+
+// deliverDueWebhooks sends the deliveries that are due until none is left, to up
+// to webhookBatchSize webhooks at once. Whenever a send finishes, it claims again
+// for the free slots, so a slow webhook holds up nothing but its own deliveries.
+// A claimed delivery is not claimed again until its one request has timed out.
+// After an error it claims no more and returns once the sends in flight finished.
+func (s Service) deliverDueWebhooks(ctx context.Context, client *http.Client) error {
+	lease := 2 * time.Duration(s.Config().Webhooks.Timeout) * time.Second
+	done := make(chan error)
+	inFlight := 0
+
+	var errs []error
+
+	for {
+		if len(errs) == 0 && inFlight < webhookBatchSize {
+			deliveries, err := s.repository.ClaimWebhookDeliveries(ctx, webhookBatchSize-inFlight, lease)
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			for _, delivery := range deliveries {
+				inFlight++
+
+				go func() {
+					done <- s.deliverWebhook(ctx, client, delivery)
+				}()
+			}
+		}
+
+		if inFlight == 0 {
+			break
+		}
+
+		if err := <-done; err != nil {
+			errs = append(errs, err)
+		}
+
+		inFlight--
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("error in Service's method deliverDueWebhooks: %w", err)
+	}
+
+	return nil
+}
+
+// deliverWebhook makes one attempt to send delivery and stores its outcome.
+func (s Service) deliverWebhook(ctx context.Context, client *http.Client, delivery WebhookDelivery) error {
+	conf := s.Config().Webhooks
+
+	now := time.Now()
+	status, err := sendWebhook(ctx, client, delivery, now)
+	delivery = nextDeliveryState(delivery, status, err, now, conf.MaxAttempts,
+		time.Duration(conf.InitialBackoff)*time.Second, time.Duration(conf.MaxBackoff)*time.Second)
+
+	observeWebhookDelivery(delivery.Status)
+
+	if delivery.Status == DeliveryFailed {
+		s.log.Warn("webhook delivery failed", slog.Int64("delivery", delivery.ID),
+			slog.Int64("webhook", delivery.WebhookID), slog.Int("attempts", delivery.Attempts))
+	}
+
+	if err := s.repository.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		return fmt.Errorf("error in Service's method deliverWebhook: %w", err)
+	}
+
+	return nil
+}
+
+// newWebhookTransport connects to public addresses only. A webhook's host was
+// checked when it was created, but it may resolve differently by the time it is
+// sent to. Proxies are not used, since the check applies to the address dialed.
+func newWebhookTransport() *http.Transport {
+	dialer := &net.Dialer{Control: webhookDialControl}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return transport
+}
+
+func webhookDialControl(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if !publicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w, got %s", errWebhookTarget, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// newWebhookClient does not follow redirects, which could lead anywhere; a
+// redirect is a response other than 2xx like any other.
+func newWebhookClient(transport http.RoundTripper, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// sendWebhook posts the payload and returns the response status. Any status
+// other than 2xx is an error.
+func sendWebhook(ctx context.Context, client *http.Client, delivery WebhookDelivery, now time.Time) (int, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	request.Header.Set("Content-Type", formatContentTypes[formatJSON])
+	request.Header.Set(HeaderWebhookEvent, delivery.Event)
+	request.Header.Set(HeaderWebhookDelivery, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(HeaderWebhookTimestamp, timestamp)
+	request.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, webhookErrorLimit))
+
+		return response.StatusCode, fmt.Errorf("%w %d: %s", errWebhookStatus, response.StatusCode, body)
+	}
+
+	return response.StatusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of timestamp, a dot and body, keyed
+// with secret. Receivers compute it to check the X-Currency-Signature header.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nextDeliveryState records an attempt that ended with status and err. A failed
+// attempt is retried after a backoff that doubles from initial up to maxBackoff,
+// until maxAttempts attempts were made.
+func nextDeliveryState(
+	delivery WebhookDelivery, status int, err error, now time.Time,
+	maxAttempts int, initial, maxBackoff time.Duration,
+) WebhookDelivery {
+	delivery.Attempts++
+	delivery.LastStatus = nil
+	delivery.LastError = nil
+
+	if status != 0 {
+		delivery.LastStatus = &status
+	}
+
+	if err == nil {
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = &now
+
+		return delivery
+	}
+
+	message := err.Error()
+	if len(message) > webhookErrorLimit {
+		message = message[:webhookErrorLimit]
+	}
+
+	delivery.LastError = &message
+
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = DeliveryFailed
+
+		return delivery
+	}
+
+	backoff := initial
+	for range delivery.Attempts - 1 {
+		if backoff >= maxBackoff/2 {
+			backoff = maxBackoff
+
+			break
+		}
+
+		backoff *= 2
+	}
+
+	delivery.Status = DeliveryPending
+	delivery.NextAttemptAt = now.Add(min(backoff, maxBackoff))
+
+	return delivery
+}
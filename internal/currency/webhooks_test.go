@@ -0,0 +1,206 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackc0der/currency/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnectionRefused = errors.New("connection refused")
+
+func TestSignWebhook(t *testing.T) {
+	t.Parallel()
+
+	// echo -n '1700000000.{"event":"rate_updated"}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "200cf1f644c1c753e92495dcebaa56b978bc37c70ec061fc984cd9b3aca232a6",
+		SignWebhook("secret", "1700000000", []byte(`{"event":"rate_updated"}`)))
+}
+
+func TestNextDeliveryState(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ok, unavailable := http.StatusOK, http.StatusServiceUnavailable
+
+	tests := []struct {
+		name        string
+		attempts    int
+		status      int
+		err         error
+		wantStatus  string
+		wantBackoff time.Duration
+	}{
+		{"delivered", 0, ok, nil, DeliveryDelivered, 0},
+		{"first retry", 0, unavailable, errWebhookStatus, DeliveryPending, 10 * time.Second},
+		{"backoff doubles", 2, unavailable, errWebhookStatus, DeliveryPending, 40 * time.Second},
+		{"backoff is capped", 7, 0, errConnectionRefused, DeliveryPending, 15 * time.Minute},
+		{"out of attempts", 9, unavailable, errWebhookStatus, DeliveryFailed, 0},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			delivery := nextDeliveryState(WebhookDelivery{Attempts: testCase.attempts, NextAttemptAt: now},
+				testCase.status, testCase.err, now, 10, 10*time.Second, 15*time.Minute)
+
+			assert.Equal(t, testCase.attempts+1, delivery.Attempts)
+			assert.Equal(t, testCase.wantStatus, delivery.Status)
+			assert.Equal(t, now.Add(testCase.wantBackoff), delivery.NextAttemptAt)
+			assert.Equal(t, testCase.err != nil, delivery.LastError != nil)
+			assert.Equal(t, testCase.status != 0, delivery.LastStatus != nil)
+			assert.Equal(t, testCase.err == nil, delivery.DeliveredAt != nil)
+		})
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	t.Parallel()
+
+	repo := new(MockRepo)
+	repo.On("InsertWebhook", mock.Anything, mock.MatchedBy(func(webhook Webhook) bool {
+		return len(webhook.Secret) == 2*webhookSecretBytes
+	})).Return(Webhook{ID: 1}, nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), nil)
+
+	_, err := svc.CreateWebhook(context.Background(), "ftp://example.com", []string{EventRateUpdated}, "")
+	require.ErrorIs(t, err, errWebhookURL)
+
+	_, err = svc.CreateWebhook(context.Background(), "/hook", []string{EventRateUpdated}, "")
+	require.ErrorIs(t, err, errWebhookURL)
+
+	_, err = svc.CreateWebhook(context.Background(), "https://example.com/hook", nil, "")
+	require.ErrorIs(t, err, errWebhookEvents)
+
+	_, err = svc.CreateWebhook(context.Background(), "https://example.com/hook", []string{"unknown"}, "")
+	require.ErrorIs(t, err, errWebhookEvents)
+
+	for _, rawURL := range []string{
+		"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://[::1]/hook", "http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data", "http://0.0.0.0/hook", "http://[::ffff:192.168.0.1]/hook",
+	} {
+		_, err = svc.CreateWebhook(context.Background(), rawURL, []string{EventRateUpdated}, "")
+		require.ErrorIs(t, err, errWebhookTarget, rawURL)
+	}
+
+	// An address literal is not looked up, unlike a host name.
+	webhook, err := svc.CreateWebhook(context.Background(), "https://203.0.113.10/hook",
+		[]string{EventNewExtreme, EventRateUpdated, EventNewExtreme}, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), webhook.ID)
+
+	inserted := repo.Calls[0].Arguments.Get(1).(Webhook) //nolint:forcetypeassert
+	assert.Equal(t, []string{EventNewExtreme, EventRateUpdated}, inserted.Events)
+}
+
+func TestWebhookClient(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan struct{}, 1)
+
+	target := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		received <- struct{}{}
+	}))
+	defer target.Close()
+
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer redirect.Close()
+
+	delivery := WebhookDelivery{ID: 1, Event: EventRateUpdated, Payload: []byte(`{}`)}
+
+	delivery.URL = target.URL
+	_, err := sendWebhook(context.Background(), newWebhookClient(newWebhookTransport(), time.Second), delivery,
+		time.Now())
+	require.ErrorIs(t, err, errWebhookTarget, "a loopback address is not dialed")
+
+	delivery.URL = redirect.URL
+	status, err := sendWebhook(context.Background(), newWebhookClient(http.DefaultTransport, time.Second), delivery,
+		time.Now())
+	require.ErrorIs(t, err, errWebhookStatus)
+	assert.Equal(t, http.StatusFound, status, "a redirect is not followed")
+	assert.Empty(t, received)
+}
+
+func TestDeliverDueWebhooks(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"event":"rate_updated"}`)
+	requests := make(chan *http.Request, 2)
+	bodies := make(chan []byte, 2)
+	fastDelivered := make(chan struct{})
+
+	fast := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		requests <- request
+		bodies <- body
+
+		writer.WriteHeader(http.StatusNoContent)
+
+		if request.Header.Get(HeaderWebhookDelivery) == "8" {
+			close(fastDelivered)
+		}
+	}))
+	defer fast.Close()
+
+	// The slow webhook only answers once the fast one was served twice, which needs them to be sent in parallel
+	// and the fast one's next delivery to be claimed while the slow one is still in flight.
+	slow := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		select {
+		case <-fastDelivered:
+			writer.WriteHeader(http.StatusOK)
+		case <-time.After(5 * time.Second):
+			writer.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer slow.Close()
+
+	conf := config.Default()
+
+	repo := new(MockRepo)
+	repo.On("ClaimWebhookDeliveries", mock.Anything, webhookBatchSize, 20*time.Second).Return([]WebhookDelivery{
+		{ID: 6, WebhookID: 2, Event: EventRateUpdated, Payload: payload, Status: DeliveryPending, URL: slow.URL},
+		{
+			ID: 7, WebhookID: 1, Event: EventRateUpdated, Payload: payload, Status: DeliveryPending,
+			URL: fast.URL, Secret: "secret",
+		},
+	}, nil).Once()
+	repo.On("ClaimWebhookDeliveries", mock.Anything, webhookBatchSize-1, 20*time.Second).Return([]WebhookDelivery{
+		{
+			ID: 8, WebhookID: 1, Event: EventRateUpdated, Payload: payload, Status: DeliveryPending,
+			URL: fast.URL, Secret: "secret",
+		},
+	}, nil).Once()
+	repo.On("ClaimWebhookDeliveries", mock.Anything, mock.Anything, 20*time.Second).Return([]WebhookDelivery(nil), nil)
+	repo.On("UpdateWebhookDelivery", mock.Anything, mock.MatchedBy(func(delivery WebhookDelivery) bool {
+		return (delivery.ID == 7 || delivery.ID == 8) && delivery.Status == DeliveryDelivered &&
+			delivery.Attempts == 1 && *delivery.LastStatus == http.StatusNoContent
+	})).Return(nil)
+	repo.On("UpdateWebhookDelivery", mock.Anything, mock.MatchedBy(func(delivery WebhookDelivery) bool {
+		return delivery.ID == 6 && delivery.Status == DeliveryDelivered
+	})).Return(nil)
+
+	svc := NewService(repo, slog.New(slog.NewTextHandler(os.Stdout, nil)), &conf)
+
+	require.NoError(t, svc.deliverDueWebhooks(context.Background(), http.DefaultClient))
+	repo.AssertNumberOfCalls(t, "UpdateWebhookDelivery", 3)
+	repo.AssertCalled(t, "ClaimWebhookDeliveries", mock.Anything, webhookBatchSize-1, 20*time.Second)
+
+	request, body := <-requests, <-bodies
+	assert.Equal(t, payload, body)
+	assert.Equal(t, EventRateUpdated, request.Header.Get(HeaderWebhookEvent))
+	assert.Equal(t, "7", request.Header.Get(HeaderWebhookDelivery))
+	assert.Equal(t, "sha256="+SignWebhook("secret", request.Header.Get(HeaderWebhookTimestamp), payload),
+		request.Header.Get(HeaderWebhookSignature))
+}
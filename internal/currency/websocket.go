@@ -0,0 +1,279 @@
+package currency
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = (wsPongWait * 9) / 10
+	wsMaxMessageSize = 4096
+	wsSendBufferSize = 32
+
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+)
+
+// The rates are public, so browser widgets on any origin may connect.
+//
+//nolint:gochecknoglobals
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(_ *http.Request) bool {
+		return true
+	},
+}
+
+// wsClientMessage is sent by a client to change its subscriptions,
+// e.g. {"action": "subscribe", "currencies": ["BTC", "ETH"]}.
+type wsClientMessage struct {
+	Action     string   `json:"action"`
+	Currencies []string `json:"currencies"`
+}
+
+type wsRateFrame struct {
+	Type string `json:"type"`
+	Currency
+}
+
+type wsStatusFrame struct {
+	Type       string   `json:"type"`
+	Currencies []string `json:"currencies,omitempty"`
+	Message    string   `json:"message,omitempty"`
+}
+
+type wsClient struct {
+	conn          *websocket.Conn
+	send          chan []byte
+	mu            sync.Mutex
+	subscriptions map[string]struct{}
+	closeOnce     sync.Once
+	done          chan struct{}
+}
+
+// ServeWebSocket upgrades the connection and pushes a JSON frame for every subscribed
+// currency after each fetch. A client that does not keep up with its send buffer is
+// disconnected instead of slowing down delivery for everyone else.
+func (e Endpoint) ServeWebSocket(writer http.ResponseWriter, request *http.Request) {
+	conn, err := upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		e.log.Error("error in Endpoint's method ServeWebSocket", slog.Any("error", err))
+
+		return
+	}
+
+	client := &wsClient{
+		conn:          conn,
+		send:          make(chan []byte, wsSendBufferSize),
+		subscriptions: make(map[string]struct{}),
+		done:          make(chan struct{}),
+	}
+
+	updates, _, unsubscribe := e.service.Updates().Subscribe(0)
+	defer unsubscribe()
+
+	go e.wsWritePump(client)
+	go e.wsReadPump(client, request)
+
+	for {
+		select {
+		case <-client.done:
+			return
+
+		case update, ok := <-updates:
+			if !ok {
+				// Dropped as a slow subscriber or the server is shutting down.
+				client.closeWith(websocket.CloseTryAgainLater, "reconnect")
+
+				return
+			}
+
+			for _, currency := range update.Currencies {
+				if !client.subscribed(currency.CurrencyName) {
+					continue
+				}
+
+				if !client.enqueue(wsRateFrame{Type: "rate", Currency: currency}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e Endpoint) wsReadPump(client *wsClient, request *http.Request) {
+	defer client.close()
+
+	client.conn.SetReadLimit(wsMaxMessageSize)
+	_ = client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var message wsClientMessage
+
+		if err := client.conn.ReadJSON(&message); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				e.log.Error("error in Endpoint's method wsReadPump", slog.Any("error", err))
+			}
+
+			return
+		}
+
+		names := make([]string, 0, len(message.Currencies))
+
+		for _, name := range message.Currencies {
+			if name = strings.ToUpper(strings.TrimSpace(name)); name != "" {
+				names = append(names, name)
+			}
+		}
+
+		switch message.Action {
+		case wsActionSubscribe:
+			client.subscribe(names)
+
+			if !client.enqueue(wsStatusFrame{Type: "subscribed", Currencies: client.subscribedNames()}) {
+				return
+			}
+
+			// Send the current prices so the widget does not wait for the next fetch.
+			for _, name := range names {
+				currency, err := e.service.GetCurrency(request.Context(), name)
+				if err != nil {
+					continue
+				}
+
+				if !client.enqueue(wsRateFrame{Type: "rate", Currency: *currency}) {
+					return
+				}
+			}
+
+		case wsActionUnsubscribe:
+			client.unsubscribe(names)
+
+			if !client.enqueue(wsStatusFrame{Type: "subscribed", Currencies: client.subscribedNames()}) {
+				return
+			}
+
+		default:
+			if !client.enqueue(wsStatusFrame{Type: "error", Message: "unknown action: " + message.Action}) {
+				return
+			}
+		}
+	}
+}
+
+func (e Endpoint) wsWritePump(client *wsClient) {
+	ticker := time.NewTicker(wsPingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		client.close()
+	}()
+
+	for {
+		select {
+		case <-client.done:
+			return
+
+		case message := <-client.send:
+			_ = client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			_ = client.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// enqueue queues a frame for the write pump. It reports false once the client
+// is gone, either because it disconnected or because its buffer overflowed.
+func (c *wsClient) enqueue(frame any) bool {
+	message, err := json.Marshal(frame)
+	if err != nil {
+		return true
+	}
+
+	select {
+	case <-c.done:
+		return false
+	case c.send <- message:
+		return true
+	default:
+		c.closeWith(websocket.CloseTryAgainLater, "too slow")
+
+		return false
+	}
+}
+
+func (c *wsClient) closeWith(code int, reason string) {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(wsWriteWait))
+	c.close()
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+func (c *wsClient) subscribe(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		c.subscriptions[name] = struct{}{}
+	}
+}
+
+func (c *wsClient) unsubscribe(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		delete(c.subscriptions, name)
+	}
+}
+
+func (c *wsClient) subscribed(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.subscriptions[strings.ToUpper(name)]
+
+	return ok
+}
+
+func (c *wsClient) subscribedNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.subscriptions))
+	for name := range c.subscriptions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,118 @@
+package currency
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type wsTestFrame struct {
+	Type         string          `json:"type"`
+	Currencies   []string        `json:"currencies"`
+	Message      string          `json:"message"`
+	CurrencyName string          `json:"currencyName"`
+	Price        decimal.Decimal `json:"currencyPrice"`
+}
+
+func dialWebSocket(t *testing.T) (*Service, *websocket.Conn) {
+	t.Helper()
+
+	repo := new(MockRepo)
+	repo.On("SelectCurrency", mock.Anything, "BTC").Return(&Currency{
+		CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(100),
+	}, nil)
+	repo.On("SelectExtremes", mock.Anything, "BTC", mock.Anything).Return([]WindowExtremes(nil), nil)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := NewService(repo, logger, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(NewEndpoint(svc, logger, nil).ServeWebSocket))
+	t.Cleanup(server.Close)
+
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+
+	response.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+
+	return svc, conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) wsTestFrame {
+	t.Helper()
+
+	var frame wsTestFrame
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	require.NoError(t, conn.ReadJSON(&frame))
+
+	return frame
+}
+
+func TestServeWebSocket(t *testing.T) {
+	t.Parallel()
+
+	svc, conn := dialWebSocket(t)
+
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Action: wsActionSubscribe, Currencies: []string{" btc "}}))
+
+	frame := readFrame(t, conn)
+	assert.Equal(t, "subscribed", frame.Type)
+	assert.Equal(t, []string{"BTC"}, frame.Currencies)
+
+	// The current price follows the subscription.
+	frame = readFrame(t, conn)
+	assert.Equal(t, "rate", frame.Type)
+	assert.Equal(t, "BTC", frame.CurrencyName)
+	assert.True(t, decimal.NewFromInt(100).Equal(frame.Price))
+
+	// Only subscribed currencies are broadcast.
+	svc.Updates().Publish([]Currency{
+		{CurrencyName: "ETH", CurrencyPrice: decimal.NewFromInt(10)},
+		{CurrencyName: "BTC", CurrencyPrice: decimal.NewFromInt(101)},
+	})
+
+	frame = readFrame(t, conn)
+	assert.Equal(t, "rate", frame.Type)
+	assert.Equal(t, "BTC", frame.CurrencyName)
+	assert.True(t, decimal.NewFromInt(101).Equal(frame.Price))
+
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Action: "watch"}))
+
+	frame = readFrame(t, conn)
+	assert.Equal(t, "error", frame.Type)
+	assert.Equal(t, "unknown action: watch", frame.Message)
+
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Action: wsActionUnsubscribe, Currencies: []string{"BTC"}}))
+
+	frame = readFrame(t, conn)
+	assert.Equal(t, "subscribed", frame.Type)
+	assert.Empty(t, frame.Currencies)
+}
+
+func TestServeWebSocketClosesOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	svc, conn := dialWebSocket(t)
+
+	// A round trip makes sure the handler has subscribed before the broadcaster closes.
+	require.NoError(t, conn.WriteJSON(wsClientMessage{Action: wsActionSubscribe}))
+	assert.Equal(t, "subscribed", readFrame(t, conn).Type)
+
+	svc.Updates().Close()
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+	_, _, err := conn.ReadMessage()
+	require.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err)
+}
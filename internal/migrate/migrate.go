@@ -0,0 +1,329 @@
+// Package migrate applies the versioned SQL migrations and records them in
+// the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// lockKey serializes migrations between replicas that start at the same time ("migr" in ASCII).
+const lockKey = 0x6d696772
+
+var (
+	errFileName        = errors.New("migration file name must look like 0001_name.up.sql")
+	errDuplicate       = errors.New("duplicate migration version")
+	errMissingPair     = errors.New("migration needs both an up and a down file")
+	errUnknownVersions = errors.New("database has migrations this binary does not know")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, or a zero AppliedAt if it is pending.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Load reads the migrations in the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error in Load: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, file := range files {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(path.Base(file), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("error in Load: %w, got %q", errFileName, file)
+		}
+
+		rawVersion, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("error in Load: %w, got %q", errFileName, file)
+		}
+
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error in Load: %w, got %q", errFileName, file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("error in Load: %w", err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != name {
+			return nil, fmt.Errorf("error in Load: %w: %d", errDuplicate, version)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("error in Load: %w: %d_%s", errMissingPair, migration.Version, migration.Name)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator applies migrations over a single connection. Every migration runs
+// in its own transaction together with its schema_migrations row.
+type Migrator struct {
+	conn       *pgx.Conn
+	migrations []Migration
+}
+
+func NewMigrator(conn *pgx.Conn, migrations []Migration) *Migrator {
+	return &Migrator{conn: conn, migrations: migrations}
+}
+
+// Up applies every pending migration in order and returns the ones it applied.
+// It refuses to run if the database has versions the binary does not know,
+// which means an older binary is running against a newer schema.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	for _, migration := range m.migrations {
+		done, err := m.inLockedTx(ctx, func(tx pgx.Tx, versions map[int64]time.Time) (bool, error) {
+			if unknown := m.unknownVersions(versions); len(unknown) > 0 {
+				return false, fmt.Errorf("%w: %v", errUnknownVersions, unknown)
+			}
+
+			if _, ok := versions[migration.Version]; ok {
+				return false, nil
+			}
+
+			if _, err := tx.Exec(ctx, migration.Up); err != nil {
+				return false, fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.Exec(ctx, "insert into schema_migrations (version, name) values ($1, $2)",
+				migration.Version, migration.Name)
+
+			return true, err //nolint:wrapcheck
+		})
+		if err != nil {
+			return applied, fmt.Errorf("error in Migrator's method Up: %w", err)
+		}
+
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+
+	return applied, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns the ones it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	for range steps {
+		var migration Migration
+
+		done, err := m.inLockedTx(ctx, func(tx pgx.Tx, versions map[int64]time.Time) (bool, error) {
+			if unknown := m.unknownVersions(versions); len(unknown) > 0 {
+				return false, fmt.Errorf("%w: %v", errUnknownVersions, unknown)
+			}
+
+			var ok bool
+
+			migration, ok = m.latestApplied(versions)
+			if !ok {
+				return false, nil
+			}
+
+			if _, err := tx.Exec(ctx, migration.Down); err != nil {
+				return false, fmt.Errorf("%d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			_, err := tx.Exec(ctx, "delete from schema_migrations where version = $1", migration.Version)
+
+			return true, err //nolint:wrapcheck
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("error in Migrator's method Down: %w", err)
+		}
+
+		if !done {
+			break
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// Status lists every known migration with the time it was applied, and the
+// versions that are applied but unknown to this binary.
+func (m *Migrator) Status(ctx context.Context) ([]Status, []int64, error) {
+	var versions map[int64]time.Time
+
+	_, err := m.inLockedTx(ctx, func(_ pgx.Tx, applied map[int64]time.Time) (bool, error) {
+		versions = applied
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error in Migrator's method Status: %w", err)
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+
+	for _, migration := range m.migrations {
+		statuses = append(statuses, Status{Migration: migration, AppliedAt: versions[migration.Version]})
+	}
+
+	return statuses, m.unknownVersions(versions), nil
+}
+
+// inLockedTx runs step in a transaction holding the migration lock, with the
+// applied versions read after the lock was taken. The schema_migrations table is
+// created under the lock as well, so that replicas starting together do not race
+// to create it.
+func (m *Migrator) inLockedTx(
+	ctx context.Context,
+	step func(pgx.Tx, map[int64]time.Time) (bool, error),
+) (bool, error) {
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("begin: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "select pg_advisory_xact_lock($1)", int64(lockKey)); err != nil {
+		return false, fmt.Errorf("lock: %w", err)
+	}
+
+	if err := ensureTable(ctx, tx); err != nil {
+		return false, err
+	}
+
+	versions, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+
+	done, err := step(tx, versions)
+	if err != nil || !done {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("commit: %w", err)
+	}
+
+	return true, nil
+}
+
+func ensureTable(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `create table if not exists schema_migrations (
+    version bigint primary key,
+    name text not null,
+    applied_at timestamptz not null default now()
+)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) latestApplied(versions map[int64]time.Time) (Migration, bool) {
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if _, ok := versions[m.migrations[i].Version]; ok {
+			return m.migrations[i], true
+		}
+	}
+
+	return Migration{}, false
+}
+
+func (m *Migrator) unknownVersions(versions map[int64]time.Time) []int64 {
+	known := make(map[int64]bool, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = true
+	}
+
+	var unknown []int64
+
+	for version := range versions {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i] < unknown[j] })
+
+	return unknown
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, db querier) (map[int64]time.Time, error) {
+	rows, err := db.Query(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("read schema_migrations: %w", err)
+		}
+
+		versions[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/crackc0der/currency/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		files        fstest.MapFS
+		wantVersions []int64
+		wantErr      error
+	}{
+		{
+			name: "ordered by version",
+			files: fstest.MapFS{
+				"0010_b.up.sql":   {Data: []byte("b up")},
+				"0010_b.down.sql": {Data: []byte("b down")},
+				"0002_a.up.sql":   {Data: []byte("a up")},
+				"0002_a.down.sql": {Data: []byte("a down")},
+			},
+			wantVersions: []int64{2, 10},
+		},
+		{
+			name:    "missing down",
+			files:   fstest.MapFS{"0001_a.up.sql": {Data: []byte("a up")}},
+			wantErr: errMissingPair,
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"0001_a.up.sql":   {Data: []byte("a up")},
+				"0001_b.down.sql": {Data: []byte("b down")},
+			},
+			wantErr: errDuplicate,
+		},
+		{
+			name:    "bad name",
+			files:   fstest.MapFS{"first.up.sql": {Data: []byte("up")}},
+			wantErr: errFileName,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			loaded, err := Load(testCase.files)
+			if testCase.wantErr != nil {
+				require.ErrorIs(t, err, testCase.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			versions := make([]int64, 0, len(loaded))
+			for _, migration := range loaded {
+				versions = append(versions, migration.Version)
+			}
+
+			assert.Equal(t, testCase.wantVersions, versions)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	t.Parallel()
+
+	loaded, err := Load(migrations.FS)
+	require.NoError(t, err)
+	assert.NotEmpty(t, loaded)
+}
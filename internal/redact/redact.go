@@ -0,0 +1,81 @@
+// Package redact hides secret values such as API keys and passwords in log output.
+package redact
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Placeholder replaces every occurrence of a secret.
+const Placeholder = "[REDACTED]"
+
+// Redactor replaces known secret values, including their URL-escaped forms,
+// since secrets often end up inside URLs and DSNs.
+type Redactor struct {
+	replacer atomic.Pointer[strings.Replacer]
+	mu       sync.Mutex
+	secrets  []string
+}
+
+// New creates a redactor for secrets. Empty secrets are ignored.
+func New(secrets ...string) *Redactor {
+	redactor := &Redactor{}
+	redactor.Add(secrets...)
+
+	return redactor
+}
+
+// Add redacts secrets as well as the ones already known, for example after a
+// configuration reload. Secrets are never forgotten: the database password and
+// bot token read at startup stay in use until a restart.
+func (r *Redactor) Add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		if secret != "" && !slices.Contains(r.secrets, secret) {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+
+	// Longer secrets first, so that one containing another is replaced whole.
+	slices.SortFunc(r.secrets, func(a, b string) int { return len(b) - len(a) })
+
+	pairs := make([]string, 0, len(r.secrets)*6) //nolint:mnd
+
+	for _, secret := range r.secrets {
+		for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret)} {
+			pairs = append(pairs, form, Placeholder)
+		}
+	}
+
+	r.replacer.Store(strings.NewReplacer(pairs...))
+}
+
+func (r *Redactor) String(value string) string {
+	return r.replacer.Load().Replace(value)
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr that redacts the message and
+// every string, error or fmt.Stringer attribute.
+func (r *Redactor) ReplaceAttr(_ []string, attr slog.Attr) slog.Attr {
+	//nolint:exhaustive
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.String(attr.Value.String()))
+	case slog.KindAny:
+		switch value := attr.Value.Any().(type) {
+		case error:
+			attr.Value = slog.StringValue(r.String(value.Error()))
+		case fmt.Stringer:
+			attr.Value = slog.StringValue(r.String(value.String()))
+		}
+	}
+
+	return attr
+}
@@ -0,0 +1,39 @@
+package redact
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errFetch = errors.New(`Get "https://currate.ru/api/?get=rates&key=s3cr%2Ft": timeout`)
+
+func TestReplaceAttr(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+
+	redactor := New("s3cr/t", "bot-token", "")
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{ReplaceAttr: redactor.ReplaceAttr}))
+
+	logger.Error("calling https://api.telegram.org/botbot-token/getUpdates",
+		slog.Any("error", errFetch), slog.String("dsn", "postgres://user:s3cr%2Ft@db/rates"))
+
+	assert.NotContains(t, out.String(), "s3cr")
+	assert.NotContains(t, out.String(), "bot-token")
+	assert.Contains(t, out.String(), "key="+Placeholder)
+	assert.Contains(t, out.String(), "/bot"+Placeholder+"/getUpdates")
+}
+
+func TestAdd(t *testing.T) {
+	t.Parallel()
+
+	redactor := New("old-key", "key")
+	redactor.Add("new-key", "")
+
+	// A reload adds secrets; the old ones may still be in use.
+	assert.Equal(t, Placeholder+" "+Placeholder+" "+Placeholder, redactor.String("old-key new-key key"))
+}
@@ -8,4 +8,4 @@ create table if not exists currency (
     last_update time(0) default now()
 );
 
-create unique index currency_name_index on currency(currency_name);
\ No newline at end of file
+create unique index if not exists currency_name_index on currency(currency_name);
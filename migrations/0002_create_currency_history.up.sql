@@ -0,0 +1,8 @@
+create table if not exists currency_history (
+    id bigserial primary key,
+    currency_name varchar(255) not null,
+    price float not null,
+    created_at timestamptz not null default now()
+);
+
+create index if not exists currency_history_name_created_at_index on currency_history(currency_name, created_at);
@@ -0,0 +1,3 @@
+drop index if exists currency_history_name_created_at_key;
+
+create index if not exists currency_history_name_created_at_index on currency_history(currency_name, created_at);
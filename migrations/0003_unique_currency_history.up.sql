@@ -0,0 +1,7 @@
+-- Backfills are idempotent on (currency_name, created_at), so drop duplicates and enforce it.
+delete from currency_history a using currency_history b
+where a.currency_name = b.currency_name and a.created_at = b.created_at and a.id > b.id;
+
+drop index if exists currency_history_name_created_at_index;
+
+create unique index if not exists currency_history_name_created_at_key on currency_history(currency_name, created_at);
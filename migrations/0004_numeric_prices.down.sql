@@ -0,0 +1,9 @@
+alter table currency_history
+    alter column price type float using price::float;
+
+alter table currency
+    alter column price type float using price::float,
+    alter column price_min type float using price_min::float,
+    alter column price_max type float using price_max::float,
+    alter column changes_per_hour type float using changes_per_hour::float,
+    alter column changes_per_hour set default 0.00;
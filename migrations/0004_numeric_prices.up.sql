@@ -0,0 +1,10 @@
+-- Store prices exactly. Existing values keep the 15 significant digits a float holds.
+alter table currency
+    alter column price type numeric using price::numeric,
+    alter column price_min type numeric using price_min::numeric,
+    alter column price_max type numeric using price_max::numeric,
+    alter column changes_per_hour type numeric using changes_per_hour::numeric,
+    alter column changes_per_hour set default 0;
+
+alter table currency_history
+    alter column price type numeric using price::numeric;
@@ -0,0 +1,7 @@
+alter table currency_history drop column if exists ingested_at;
+
+alter table currency drop column if exists quoted_at;
+
+alter table currency
+    alter column last_update drop not null,
+    alter column last_update type time(0) using last_update::time(0);
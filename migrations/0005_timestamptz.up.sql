@@ -0,0 +1,25 @@
+-- last_update was a time of day without a date or zone. Take it to be today in the session's zone,
+-- which is how now() was truncated into it.
+alter table currency
+    alter column last_update type timestamptz using (current_date + last_update)::timestamptz;
+
+update currency set last_update = now() where last_update is null;
+
+alter table currency
+    alter column last_update set not null,
+    add column if not exists quoted_at timestamptz;
+
+update currency set quoted_at = last_update where quoted_at is null;
+
+alter table currency
+    alter column quoted_at set default now(),
+    alter column quoted_at set not null;
+
+-- created_at is the time a price applies to; ingested_at is when it was stored.
+alter table currency_history add column if not exists ingested_at timestamptz;
+
+update currency_history set ingested_at = created_at where ingested_at is null;
+
+alter table currency_history
+    alter column ingested_at set default now(),
+    alter column ingested_at set not null;
@@ -0,0 +1,4 @@
+create table if not exists bot_chat (
+    chat_id bigint primary key,
+    timezone text not null
+);
@@ -0,0 +1,13 @@
+create table if not exists quarantined_quote (
+    id bigserial primary key,
+    currency_name varchar(255) not null,
+    price numeric not null,
+    reference numeric not null,
+    reason text not null,
+    quoted_at timestamptz not null,
+    received_at timestamptz not null default now(),
+    status text not null default 'pending' check (status in ('pending', 'accepted', 'rejected')),
+    resolved_at timestamptz
+);
+
+create index if not exists quarantined_quote_status_index on quarantined_quote(status, received_at);
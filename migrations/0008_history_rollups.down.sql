@@ -0,0 +1,6 @@
+drop table if exists currency_history_daily;
+drop table if exists currency_history_hourly;
+
+drop index if exists currency_history_pending_rollup_index;
+
+alter table currency_history drop column if exists rolled_up;
@@ -0,0 +1,25 @@
+-- rolled_up marks raw ticks already merged into the hourly and daily aggregates,
+-- so only those are ever deleted by the retention job.
+alter table currency_history add column if not exists rolled_up boolean not null default false;
+
+create index if not exists currency_history_pending_rollup_index on currency_history(id) where not rolled_up;
+
+-- open_at and close_at keep the times of the first and last prices, so that
+-- late and backfilled ticks merge into a bucket in time order.
+create table if not exists currency_history_hourly (
+    currency_name varchar(255) not null,
+    bucket timestamptz not null,
+    open numeric not null,
+    open_at timestamptz not null,
+    high numeric not null,
+    low numeric not null,
+    close numeric not null,
+    close_at timestamptz not null,
+    samples bigint not null,
+    primary key (currency_name, bucket)
+);
+
+create table if not exists currency_history_daily (like currency_history_hourly including all);
+
+create index if not exists currency_history_hourly_bucket_index on currency_history_hourly(bucket);
+create index if not exists currency_history_daily_bucket_index on currency_history_daily(bucket);
@@ -0,0 +1,26 @@
+create table if not exists webhook (
+    id bigserial primary key,
+    url text not null,
+    secret text not null,
+    events text[] not null,
+    created_at timestamptz not null default now()
+);
+
+-- The delivery queue: a delivery stays pending, with its next attempt scheduled
+-- by exponential backoff, until it is delivered or runs out of attempts.
+create table if not exists webhook_delivery (
+    id bigserial primary key,
+    webhook_id bigint not null references webhook(id) on delete cascade,
+    event text not null,
+    payload jsonb not null,
+    status text not null default 'pending' check (status in ('pending', 'delivered', 'failed')),
+    attempts integer not null default 0,
+    next_attempt_at timestamptz not null default now(),
+    last_status integer,
+    last_error text,
+    created_at timestamptz not null default now(),
+    delivered_at timestamptz
+);
+
+create index if not exists webhook_delivery_due_index on webhook_delivery(next_attempt_at) where status = 'pending';
+create index if not exists webhook_delivery_webhook_index on webhook_delivery(webhook_id, created_at);
@@ -0,0 +1,4 @@
+drop index if exists quarantined_quote_pending_index;
+
+alter table quarantined_quote drop column if exists notified_at;
+alter table quarantined_quote drop column if exists occurrences;
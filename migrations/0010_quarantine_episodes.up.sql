@@ -0,0 +1,16 @@
+-- Keep one pending quote per currency: a repeated suspicious price updates it
+-- instead of queueing another one, and only a new pending quote is notified.
+update quarantined_quote as older set status = 'rejected', resolved_at = now()
+where status = 'pending' and exists (
+    select 1 from quarantined_quote as newer
+    where newer.currency_name = older.currency_name and newer.status = 'pending' and newer.id > older.id
+);
+
+alter table quarantined_quote add column if not exists occurrences integer not null default 1;
+alter table quarantined_quote add column if not exists notified_at timestamptz;
+
+-- Quotes quarantined before this migration were notified by the process that quarantined them.
+update quarantined_quote set notified_at = received_at;
+
+create unique index if not exists quarantined_quote_pending_index on quarantined_quote(currency_name)
+    where status = 'pending';
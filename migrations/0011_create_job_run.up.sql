@@ -0,0 +1,6 @@
+-- When each scheduled job last ran on any replica, to catch up on runs missed
+-- while no replica was leading.
+create table if not exists job_run (
+    job text primary key,
+    last_run_at timestamptz not null
+);
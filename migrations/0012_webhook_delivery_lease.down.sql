@@ -0,0 +1,2 @@
+drop index if exists webhook_delivery_pending_index;
+alter table webhook_delivery drop column if exists leased_until;
@@ -0,0 +1,5 @@
+-- A webhook is sent its deliveries in order, one at a time: only its oldest
+-- pending delivery is claimed, once it is due and not leased by a worker.
+alter table webhook_delivery add column if not exists leased_until timestamptz;
+
+create index if not exists webhook_delivery_pending_index on webhook_delivery(webhook_id, id) where status = 'pending';
@@ -1 +0,0 @@
-drop database currency;
\ No newline at end of file